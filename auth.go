@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"strings"
+)
+
+// parseSecrets parses `token1=key1,key2;token2=key3`, the destinations are WeCom bot keys
+func parseSecrets(s string) []*SecretConfig {
+	secrets := []*SecretConfig{}
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			continue
+		}
+		secret := &SecretConfig{Token: strings.TrimSpace(parts[0])}
+		for _, key := range strings.Split(parts[1], ",") {
+			if key = strings.TrimSpace(key); len(key) > 0 {
+				secret.Destinations = append(secret.Destinations, key)
+			}
+		}
+		if len(secret.Destinations) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// legacyDestination the name of the targets of legacy mode
+const legacyDestination = "legacy"
+
+// legacyTarget in legacy mode an unknown token is used as the WeCom bot key itself
+func legacyTarget(token string) Target {
+	notifier, _ := NewWeCom(&WeComConfig{Key: token})
+	return Target{Name: legacyDestination, Notifier: notifier, Template: TemplateMarkdown, Renderer: defaultTemplate}
+}
+
+// lookupSecret compares every configured token in constant time
+func (c *Config) lookupSecret(token string) (*SecretConfig, bool) {
+	sum := sha256.Sum256([]byte(token))
+	var found *SecretConfig
+	for _, secret := range c.Secrets {
+		expect := sha256.Sum256([]byte(secret.Token))
+		if subtle.ConstantTimeCompare(sum[:], expect[:]) == 1 {
+			found = secret
+		}
+	}
+	return found, found != nil
+}
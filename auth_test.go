@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLookupSecret(t *testing.T) {
+	cfg := &Config{Secrets: []*SecretConfig{{Name: "a", Token: "token-a"}, {Name: "b", Token: "token-b"}}}
+	for token, want := range map[string]string{"token-a": "a", "token-b": "b"} {
+		if secret, ok := cfg.lookupSecret(token); !ok || secret.Name != want {
+			t.Errorf("token %q: secret %v, want %s", token, secret, want)
+		}
+	}
+	for _, token := range []string{"", "token-", "token-a ", "token-ab", "TOKEN-A"} {
+		if secret, ok := cfg.lookupSecret(token); ok {
+			t.Errorf("token %q: matched secret %s", token, secret.Name)
+		}
+	}
+}
+
+func TestSecretTokenReachesRoutes(t *testing.T) {
+	post := serveWebhook(t, routedConfig(true))
+	w, jobs := post("s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if names := jobNames(jobs); strings.Join(names, ",") != "wecom,slack" {
+		t.Fatalf("queued %v, want the secret destination and the route", names)
+	}
+}
+
+func TestUnknownTokenRejected(t *testing.T) {
+	post := serveWebhook(t, routedConfig(false))
+	for _, token := range []string{"", "s3cre", "s3cret ", "S3CRET"} {
+		w, jobs := post(token)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("token %q: status %d, want 403", token, w.Code)
+		}
+		if len(jobs) > 0 {
+			t.Errorf("token %q: queued %v", token, jobNames(jobs))
+		}
+	}
+	resp := &WxResp{}
+	w, _ := post("wrong")
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.ErrCode != 403 {
+		t.Errorf("response %s, want a 403 WxResp", w.Body)
+	}
+}
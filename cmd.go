@@ -1,17 +1,55 @@
 package main
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+var configStore *ConfigStore
+
+var queue *Queue
+
+var dedup *Dedup
+
+// envInt the positive integer of the env, or def
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
 func main() {
 	if len(os.Getenv("BotDebug")) == 0 {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	var err error
+	configStore, err = NewConfigStore(os.Getenv("BotConfig"))
+	if err != nil {
+		log.Fatalf("Load config failed: %s", err)
+	}
+	configStore.Watch()
+	var outbox *Outbox
+	var stored map[int64]*storedJob
+	if dir := os.Getenv("BotDataDir"); len(dir) > 0 {
+		if outbox, stored, err = OpenOutbox(dir); err != nil {
+			log.Fatalf("Open outbox failed: %s", err)
+		}
+	}
+	queue = NewQueue(envInt("BotQueueSize", 1000), envInt("BotWorkers", 4), envInt("BotMaxRetries", 8), outbox)
+	queue.Replay(configStore.Get(), stored)
+	dedup = NewDedup(envInt("BotDedupSize", 10000), time.Duration(envInt("BotDedupTTL", 3600))*time.Second)
+	if cfg := configStore.Get(); len(cfg.Secrets) == 0 && !cfg.Legacy {
+		log.Println("No secrets configured, all requests will be rejected")
+	}
 	r := gin.Default()
 	r.POST("/", TransmitRobot)
+	r.POST("/preview", PreviewTemplate)
+	r.GET("/metrics", ServeMetrics)
 	listenAddr := os.Getenv("listenAddr")
 	if len(listenAddr) == 0 {
 		listenAddr = "0.0.0.0:9090"
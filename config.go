@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes where the gitlab events are transmitted
+type Config struct {
+	Legacy       bool                          `json:"legacy" yaml:"legacy"`
+	Secrets      []*SecretConfig               `json:"secrets" yaml:"secrets"`
+	Destinations map[string]*DestinationConfig `json:"destinations" yaml:"destinations"`
+	Routes       []*Route                      `json:"routes" yaml:"routes"`
+	Users        []*UserConfig                 `json:"users" yaml:"users"`
+	Templates    map[string]TemplateConfig     `json:"templates" yaml:"templates"`
+	// Locale the default locale of the builtin templates, en-US or zh-CN, empty for the original messages
+	Locale string `json:"locale" yaml:"locale"`
+
+	notifiers map[string]Notifier
+	templates map[string]*EventTemplate
+}
+
+// SecretConfig a webhook secret token, events carrying it are always sent to Destinations
+type SecretConfig struct {
+	Name         string   `json:"name" yaml:"name"`
+	Token        string   `json:"token" yaml:"token"`
+	Destinations []string `json:"destinations" yaml:"destinations"`
+}
+
+// DestinationConfig exactly one backend must be set
+type DestinationConfig struct {
+	WeCom      *WeComConfig      `json:"wecom" yaml:"wecom"`
+	DingTalk   *DingTalkConfig   `json:"dingtalk" yaml:"dingtalk"`
+	Feishu     *FeishuConfig     `json:"feishu" yaml:"feishu"`
+	Slack      *SlackConfig      `json:"slack" yaml:"slack"`
+	Teams      *TeamsConfig      `json:"teams" yaml:"teams"`
+	Telegram   *TelegramConfig   `json:"telegram" yaml:"telegram"`
+	Discord    *DiscordConfig    `json:"discord" yaml:"discord"`
+	Mattermost *MattermostConfig `json:"mattermost" yaml:"mattermost"`
+	RocketChat *MattermostConfig `json:"rocketchat" yaml:"rocketchat"`
+	Email      *EmailConfig      `json:"email" yaml:"email"`
+	Webhook    *WebhookConfig    `json:"webhook" yaml:"webhook"`
+	Matrix     *MatrixConfig     `json:"matrix" yaml:"matrix"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	} else {
+		err = yaml.UnmarshalStrict(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %s", path, err)
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// configFromEnv builds the config from BotSecrets and BotLegacy when no config file is given
+func configFromEnv() (*Config, error) {
+	cfg := &Config{
+		Legacy:       len(os.Getenv("BotLegacy")) > 0,
+		Destinations: map[string]*DestinationConfig{},
+	}
+	for i, secret := range parseSecrets(os.Getenv("BotSecrets")) {
+		secret.Name = fmt.Sprintf("env%d", i)
+		for _, key := range secret.Destinations {
+			cfg.Destinations[key] = &DestinationConfig{WeCom: &WeComConfig{Key: key}}
+		}
+		cfg.Secrets = append(cfg.Secrets, secret)
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	c.notifiers = map[string]Notifier{}
+	for name, dest := range c.Destinations {
+		if err := dest.validate(); err != nil {
+			return fmt.Errorf("destination %q: %s", name, err)
+		}
+		notifier, err := dest.notifier()
+		if err != nil {
+			return fmt.Errorf("destination %q: %s", name, err)
+		}
+		c.notifiers[name] = notifier
+	}
+	if err := checkLocale(c.Locale); err != nil {
+		return err
+	}
+	c.templates = map[string]*EventTemplate{}
+	for name, cfg := range c.Templates {
+		if name == TemplateMarkdown || name == TemplateText || name == TemplateCard {
+			return fmt.Errorf("template %q: the name is builtin", name)
+		}
+		template, err := parseTemplate(name, cfg)
+		if err != nil {
+			return fmt.Errorf("template %q: %s", name, err)
+		}
+		c.templates[name] = template
+	}
+	tokens := map[string]bool{}
+	for i, secret := range c.Secrets {
+		if len(secret.Name) == 0 {
+			secret.Name = fmt.Sprintf("secret%d", i)
+		}
+		if len(secret.Token) == 0 {
+			return fmt.Errorf("secret %q: token is empty", secret.Name)
+		}
+		if tokens[secret.Token] {
+			return fmt.Errorf("secret %q: duplicate token", secret.Name)
+		}
+		tokens[secret.Token] = true
+		if err := c.checkDestinations(secret.Destinations); err != nil {
+			return fmt.Errorf("secret %q: %s", secret.Name, err)
+		}
+	}
+	for i, route := range c.Routes {
+		if len(route.Name) == 0 {
+			route.Name = fmt.Sprintf("route%d", i)
+		}
+		if err := route.validate(c); err != nil {
+			return fmt.Errorf("route %q: %s", route.Name, err)
+		}
+	}
+	for i, user := range c.Users {
+		if err := user.validate(); err != nil {
+			return fmt.Errorf("user %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) checkDestinations(names []string) error {
+	for _, name := range names {
+		if _, ok := c.Destinations[name]; !ok {
+			return fmt.Errorf("unknown destination %q", name)
+		}
+	}
+	return nil
+}
+
+func (d *DestinationConfig) validate() error {
+	if d == nil {
+		return fmt.Errorf("no backend configured")
+	}
+	n := 0
+	backends := []bool{
+		d.WeCom != nil, d.DingTalk != nil, d.Feishu != nil, d.Slack != nil, d.Teams != nil,
+		d.Telegram != nil, d.Discord != nil, d.Mattermost != nil, d.RocketChat != nil, d.Email != nil, d.Webhook != nil, d.Matrix != nil,
+	}
+	for _, set := range backends {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("exactly one backend must be configured, got %d", n)
+	}
+	return nil
+}
+
+// ConfigStore holds the last good config, requests keep the snapshot they started with across reloads
+type ConfigStore struct {
+	mu      sync.RWMutex
+	cfg     *Config
+	path    string
+	modTime time.Time
+}
+
+func NewConfigStore(path string) (*ConfigStore, error) {
+	s := &ConfigStore{path: path}
+	if len(path) == 0 {
+		cfg, err := configFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		s.cfg = cfg
+		return s, nil
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ConfigStore) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// Reload loads the config file, an invalid config is rejected and the last good one kept
+func (s *ConfigStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(s.path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+	s.cfg = cfg
+	return nil
+}
+
+// Watch reloads the config on SIGHUP or when the file changes
+func (s *ConfigStore) Watch() {
+	if len(s.path) == 0 {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(2 * time.Second)
+	go func() {
+		for {
+			select {
+			case <-hup:
+			case <-ticker.C:
+				info, err := os.Stat(s.path)
+				s.mu.RLock()
+				changed := err == nil && !info.ModTime().Equal(s.modTime)
+				s.mu.RUnlock()
+				if !changed {
+					continue
+				}
+			}
+			if err := s.Reload(); err != nil {
+				log.Printf("Reload config failed, keep the last good one: %s", err)
+				continue
+			}
+			log.Printf("Config %s reloaded", s.path)
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Dedup remembers the recently seen event ids, at most size of them for ttl
+type Dedup struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	size  int
+	seen  map[string]*list.Element
+	order *list.List
+}
+
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+func NewDedup(size int, ttl time.Duration) *Dedup {
+	return &Dedup{ttl: ttl, size: size, seen: map[string]*list.Element{}, order: list.New()}
+}
+
+// Add records the key, it returns false when the key was seen within ttl
+func (d *Dedup) Add(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	// the oldest entries are at the front
+	for e := d.order.Front(); e != nil && now.Sub(e.Value.(*dedupEntry).at) > d.ttl; e = d.order.Front() {
+		d.remove(e)
+	}
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	if d.order.Len() >= d.size {
+		d.remove(d.order.Front())
+	}
+	d.seen[key] = d.order.PushBack(&dedupEntry{key: key, at: now})
+	return true
+}
+
+func (d *Dedup) remove(e *list.Element) {
+	delete(d.seen, e.Value.(*dedupEntry).key)
+	d.order.Remove(e)
+}
+
+// Remove forgets the key, for the events that were not handled and will be sent again
+func (d *Dedup) Remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.seen[key]; ok {
+		d.remove(e)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dingTalkURL = "https://oapi.dingtalk.com/robot/send"
+
+type DingTalkConfig struct {
+	AccessToken string   `json:"access_token" yaml:"access_token"`
+	Secret      string   `json:"secret" yaml:"secret"`
+	URL         string   `json:"url" yaml:"url"`
+	MsgType     string   `json:"msgtype" yaml:"msgtype"`
+	AtMobiles   []string `json:"at_mobiles" yaml:"at_mobiles"`
+	AtAll       bool     `json:"at_all" yaml:"at_all"`
+}
+
+// DingTalk custom robot, requests are signed when Secret is set
+type DingTalk struct {
+	cfg    *DingTalkConfig
+	client *http.Client
+}
+
+type dingTalkMsg struct {
+	MsgType    string              `json:"msgtype"`
+	Text       *dingTalkText       `json:"text,omitempty"`
+	Markdown   *dingTalkMarkdown   `json:"markdown,omitempty"`
+	ActionCard *dingTalkActionCard `json:"actionCard,omitempty"`
+	At         *dingTalkAt         `json:"at,omitempty"`
+}
+
+type dingTalkText struct {
+	Content string `json:"content"`
+}
+
+type dingTalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type dingTalkActionCard struct {
+	Title       string `json:"title"`
+	Text        string `json:"text"`
+	SingleTitle string `json:"singleTitle"`
+	SingleURL   string `json:"singleURL"`
+}
+
+type dingTalkAt struct {
+	AtMobiles []string `json:"atMobiles,omitempty"`
+	IsAtAll   bool     `json:"isAtAll"`
+}
+
+func NewDingTalk(cfg *DingTalkConfig) (*DingTalk, error) {
+	if len(cfg.AccessToken) == 0 {
+		return nil, fmt.Errorf("dingtalk.access_token is empty")
+	}
+	switch cfg.MsgType {
+	case "":
+		cfg.MsgType = "markdown"
+	case "markdown", "actionCard":
+	default:
+		return nil, fmt.Errorf("dingtalk.msgtype must be markdown or actionCard")
+	}
+	if len(cfg.URL) == 0 {
+		cfg.URL = dingTalkURL
+	}
+	return &DingTalk{cfg: cfg, client: NewClient()}, nil
+}
+
+// sign returns timestamp and sign, sign is base64(HmacSHA256(secret, timestamp+"\n"+secret))
+func (d *DingTalk) sign(now time.Time) (string, string) {
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(d.cfg.Secret))
+	mac.Write([]byte(timestamp + "\n" + d.cfg.Secret))
+	return timestamp, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (d *DingTalk) buildMsg(msg *Message) *dingTalkMsg {
+	at := &dingTalkAt{AtMobiles: d.cfg.AtMobiles, IsAtAll: d.cfg.AtAll}
+	content := msg.Content
+	// the mobiles must appear in the content to be highlighted
+	for _, mobile := range at.AtMobiles {
+		content += " @" + mobile
+	}
+	if !msg.Markdown {
+		return &dingTalkMsg{MsgType: "text", Text: &dingTalkText{Content: content}, At: at}
+	}
+	// dingtalk markdown needs a blank line to break
+	content = strings.ReplaceAll(content, "\n", "\n\n")
+	if d.cfg.MsgType == "actionCard" && len(msg.URL) > 0 {
+		return &dingTalkMsg{MsgType: "actionCard", ActionCard: &dingTalkActionCard{Title: msg.Title, Text: content, SingleTitle: "Detail>>", SingleURL: msg.URL}, At: at}
+	}
+	return &dingTalkMsg{MsgType: "markdown", Markdown: &dingTalkMarkdown{Title: msg.Title, Text: content}, At: at}
+}
+
+func (d *DingTalk) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+// dingTalkMaxContent dingtalk rejects messages over 20000 bytes
+const dingTalkMaxContent = 20000
+
+// Limit the room left by the mobiles appended to the content, in markdown every line break is doubled
+// so that the content may grow to twice its size
+func (d *DingTalk) Limit(msg *Message) int {
+	limit := dingTalkMaxContent
+	for _, mobile := range d.cfg.AtMobiles {
+		limit -= len(" @" + mobile)
+	}
+	if msg.Markdown {
+		limit /= 2
+	}
+	return limit
+}
+
+func (d *DingTalk) Send(msg *Message) (*WxResp, error) {
+	query := url.Values{}
+	query.Set("access_token", d.cfg.AccessToken)
+	if len(d.cfg.Secret) > 0 {
+		timestamp, sign := d.sign(time.Now())
+		query.Set("timestamp", timestamp)
+		query.Set("sign", sign)
+	}
+	data, err := json.Marshal(d.buildMsg(msg))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Post(d.cfg.URL+"?"+query.Encode(), "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request dingtalk robot err: %s", err)
+	}
+	defer resp.Body.Close()
+	// dingtalk answers with errcode and errmsg as wexin does
+	wxResp := &WxResp{}
+	if err = json.NewDecoder(resp.Body).Decode(wxResp); err != nil {
+		return nil, fmt.Errorf("Decode dingtalk response err: %s, status %d", err, resp.StatusCode)
+	}
+	return wxResp, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDingTalkLimitAfterFormatting(t *testing.T) {
+	dingtalk, err := NewDingTalk(&DingTalkConfig{AccessToken: "token", AtMobiles: []string{"13800000000", "13800000001"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, markdown := range []bool{false, true} {
+		msg := &Message{Title: "project", Markdown: markdown}
+		// the worst case, every byte is a line break
+		msg.Content = strings.Repeat("\n", dingtalk.Limit(msg))
+		body := dingtalk.buildMsg(msg)
+		content := ""
+		switch {
+		case body.Text != nil:
+			content = body.Text.Content
+		case body.Markdown != nil:
+			content = body.Markdown.Text
+		}
+		if len(content) > dingTalkMaxContent {
+			t.Errorf("markdown %v: content of %d bytes, want at most %d", markdown, len(content), dingTalkMaxContent)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// discord limits of a message
+const (
+	discordMaxEmbeds      = 10
+	discordMaxTotal       = 6000
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFieldValue  = 1024
+)
+
+type DiscordConfig struct {
+	Webhook   string `json:"webhook" yaml:"webhook"`
+	Username  string `json:"username" yaml:"username"`
+	AvatarURL string `json:"avatar_url" yaml:"avatar_url"`
+}
+
+// Discord webhook, events are sent as embeds
+type Discord struct {
+	cfg    *DiscordConfig
+	client *http.Client
+}
+
+type discordMsg struct {
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	Embeds    []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordResp struct {
+	Message    string  `json:"message"`
+	Code       int64   `json:"code"`
+	RetryAfter float64 `json:"retry_after"`
+}
+
+func NewDiscord(cfg *DiscordConfig) (*Discord, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("discord.webhook is empty")
+	}
+	return &Discord{cfg: cfg, client: NewClient()}, nil
+}
+
+func (d *Discord) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+// Limit the embed description, the total of the embeds is checked by limitEmbeds
+func (d *Discord) Limit(msg *Message) int {
+	return discordMaxDescription
+}
+
+// truncateRunes cuts s to at most n characters, discord counts characters rather than bytes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
+
+func buildDiscordEmbed(e *Event, content string) discordEmbed {
+	embed := discordEmbed{
+		Title:       truncateRunes(e.Project+" · "+e.Summary(), discordMaxTitle),
+		URL:         e.URL,
+		Description: truncateRunes(content, discordMaxDescription),
+		Color:       eventColor(e),
+	}
+	addField := func(name, value string) {
+		if len(value) > 0 {
+			embed.Fields = append(embed.Fields, discordField{Name: name, Value: truncateRunes(value, discordMaxFieldValue), Inline: true})
+		}
+	}
+	if e.Tag {
+		addField(e.tr("Tag"), e.Ref)
+	} else {
+		addField(e.tr("Branch"), e.Ref)
+	}
+	addField(e.tr("Author"), e.Author)
+	addField(e.tr("Status"), e.tr(e.Status))
+	addField(e.tr("Duration"), formatDuration(e.Duration))
+	if t, ok := parseTime(e.Time()); ok {
+		embed.Timestamp = t.Format(time.RFC3339)
+	}
+	return embed
+}
+
+// limitEmbeds keeps at most 10 embeds and shortens descriptions until all of them fit into 6000 characters
+func limitEmbeds(embeds []discordEmbed) []discordEmbed {
+	if len(embeds) > discordMaxEmbeds {
+		embeds = embeds[:discordMaxEmbeds]
+	}
+	total := 0
+	for _, embed := range embeds {
+		total += runeLen(embed.Title) + runeLen(embed.Description)
+		for _, field := range embed.Fields {
+			total += runeLen(field.Name) + runeLen(field.Value)
+		}
+	}
+	for i := len(embeds) - 1; i >= 0 && total > discordMaxTotal; i-- {
+		over := total - discordMaxTotal
+		length := runeLen(embeds[i].Description)
+		keep := length - over
+		if keep < 0 {
+			keep = 0
+		}
+		embeds[i].Description = truncateRunes(embeds[i].Description, keep)
+		total -= length - runeLen(embeds[i].Description)
+	}
+	return embeds
+}
+
+func (d *Discord) buildMsg(msg *Message) *discordMsg {
+	body := &discordMsg{Username: d.cfg.Username, AvatarURL: d.cfg.AvatarURL}
+	if msg.Event == nil || !msg.Markdown {
+		body.Content = truncateRunes(msg.Content, 2000)
+		return body
+	}
+	body.Embeds = limitEmbeds([]discordEmbed{buildDiscordEmbed(msg.Event, msg.body(MarkdownMarkup))})
+	return body
+}
+
+func (d *Discord) Send(msg *Message) (*WxResp, error) {
+	data, err := json.Marshal(d.buildMsg(msg))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Post(d.cfg.Webhook, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request discord webhook err: %s", err)
+	}
+	defer resp.Body.Close()
+	// discord answers 204 without a body on success
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+	}
+	text, _ := ioutil.ReadAll(resp.Body)
+	discordResp := &discordResp{}
+	if err = json.Unmarshal(text, discordResp); err != nil {
+		return statusResp(resp, text)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &RetryError{After: time.Duration(discordResp.RetryAfter * float64(time.Second)), Msg: discordResp.Message}
+	}
+	return &WxResp{ErrCode: int64(resp.StatusCode), ErrMsg: discordResp.Message}, nil
+}
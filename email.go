@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultEmailSubject = "[{{.Project}}] {{.Summary}}"
+
+type EmailConfig struct {
+	Host     string   `json:"host" yaml:"host"`
+	Port     int      `json:"port" yaml:"port"`
+	Username string   `json:"username" yaml:"username"`
+	Password string   `json:"password" yaml:"password"`
+	From     string   `json:"from" yaml:"from"`
+	To       []string `json:"to" yaml:"to"`
+	// TLS starttls, tls for implicit tls or none
+	TLS     string `json:"tls" yaml:"tls"`
+	Subject string `json:"subject" yaml:"subject"`
+}
+
+// Email sends multipart html and plaintext mails through smtp
+type Email struct {
+	cfg     *EmailConfig
+	subject *template.Template
+}
+
+func NewEmail(cfg *EmailConfig) (*Email, error) {
+	if len(cfg.Host) == 0 {
+		return nil, fmt.Errorf("email.host is empty")
+	}
+	if len(cfg.From) == 0 {
+		return nil, fmt.Errorf("email.from is empty")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("email.tls must be starttls, tls or none")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == "tls" {
+			cfg.Port = 465
+		}
+	}
+	if len(cfg.Subject) == 0 {
+		cfg.Subject = defaultEmailSubject
+	}
+	subject, err := template.New("subject").Parse(cfg.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("email.subject: %s", err)
+	}
+	return &Email{cfg: cfg, subject: subject}, nil
+}
+
+func (m *Email) Markup() *Markup {
+	return HTMLMarkup
+}
+
+func (m *Email) Limit(msg *Message) int {
+	return 0
+}
+
+func (m *Email) renderSubject(msg *Message) string {
+	if msg.Event == nil {
+		return msg.Title
+	}
+	buf := &bytes.Buffer{}
+	if err := m.subject.Execute(buf, msg.Event); err != nil {
+		return msg.Title
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// buildMail builds a multipart/alternative mail, the plaintext part is rendered again from the event
+func (m *Email) buildMail(msg *Message, to []string) ([]byte, error) {
+	plain := msg.Content
+	if msg.Event != nil {
+		plain = msg.render(PlainMarkup)
+	}
+	html := "<html><body>" + strings.ReplaceAll(msg.Content, "\n", "<br>\n") + "</body></html>"
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	headers := [][2]string{
+		{"From", m.cfg.From},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.renderSubject(msg))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(m.cfg.From)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + writer.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{{"text/plain", plain}, {"text/html", html}} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "gitlabot"
+	if i := strings.LastIndex(address(from), "@"); i >= 0 {
+		domain = address(from)[i+1:]
+	}
+	return fmt.Sprintf("<%x@%s>", b, domain)
+}
+
+// address strips the display name of `Name <user@example.com>`
+func address(s string) string {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr.Address
+	}
+	return s
+}
+
+func (m *Email) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	if m.cfg.TLS == "tls" {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, m.cfg.Host)
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	if m.cfg.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (m *Email) Send(msg *Message) (*WxResp, error) {
+	to := msg.Recipients
+	if len(to) == 0 {
+		to = m.cfg.To
+	}
+	if len(to) == 0 {
+		return &WxResp{ErrCode: 0, ErrMsg: "no recipients"}, nil
+	}
+	data, err := m.buildMail(msg, to)
+	if err != nil {
+		return nil, err
+	}
+	err = m.sendMail(to, data)
+	// the smtp server rejected the mail permanently, retrying won't help
+	if smtpErr, ok := err.(*textproto.Error); ok && smtpErr.Code >= 500 {
+		return &WxResp{ErrCode: int64(smtpErr.Code), ErrMsg: smtpErr.Msg}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Send email err: %s", err)
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+}
+
+// Retryable the smtp codes in the response are permanent failures, the temporary ones are returned as errors
+func (m *Email) Retryable(resp *WxResp) bool {
+	return false
+}
+
+func (m *Email) sendMail(to []string, data []byte) error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if len(m.cfg.Username) > 0 {
+		if err = client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(address(m.cfg.From)); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = client.Rcpt(address(rcpt)); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Event a gitlab event normalized from the different hook bodies, every backend renders it on its own
+type Event struct {
+	UUID           string        `json:"uuid"`
+	Kind           string        `json:"kind"`
+	ObjectKind     string        `json:"object_kind"`
+	Project        string        `json:"project"`
+	ProjectPath    string        `json:"project_path"`
+	ProjectURL     string        `json:"project_url"`
+	Ref            string        `json:"ref"`
+	RawRef         string        `json:"raw_ref"`
+	Tag            bool          `json:"tag"`
+	Author         string        `json:"author"`
+	AuthorUsername string        `json:"author_username"`
+	AuthorEmail    string        `json:"author_email"`
+	Labels         []string      `json:"labels"`
+	Action         string        `json:"action"`
+	Title          string        `json:"title"`
+	URL            string        `json:"url"`
+	Status         string        `json:"status"`
+	Note           string        `json:"note"`
+	SourceBranch   string        `json:"source_branch"`
+	TargetBranch   string        `json:"target_branch"`
+	CreatedAt      string        `json:"created_at"`
+	UpdatedAt      string        `json:"updated_at"`
+	FinishedAt     string        `json:"finished_at"`
+	Duration       int64         `json:"duration"`
+	Commits        []EventCommit `json:"commits"`
+	// MoreCommits the commits of the push not in Commits
+	MoreCommits int    `json:"more_commits"`
+	CompareURL  string `json:"compare_url"`
+	Removed     bool   `json:"removed"`
+	// Job the name of the failed job, with its Stage, the FailureReason of gitlab and the description of the Runner
+	Job           string `json:"job"`
+	Stage         string `json:"stage"`
+	FailureReason string `json:"failure_reason"`
+	Runner        string `json:"runner"`
+	// Environment the environment of a deployment, its tier and external url
+	Environment     string `json:"environment"`
+	EnvironmentTier string `json:"environment_tier"`
+	EnvironmentURL  string `json:"environment_url"`
+	// Description the release notes in markdown, with the links to the Assets
+	Description string      `json:"description"`
+	Assets      []EventLink `json:"assets"`
+	// Locale the locale of the target the event is sent to, Summary and the card labels are translated into it
+	Locale string `json:"locale,omitempty"`
+	// Mentions the users to ping, the trigger of a failed pipeline or job or the assignees and reviewers of a new merge request
+	Mentions []EventUser `json:"mentions"`
+}
+
+type EventCommit struct {
+	Id        string `json:"id"`
+	Message   string `json:"message"`
+	TimeStamp string `json:"timestamp"`
+	Url       string `json:"url"`
+	Author    string `json:"author"`
+}
+
+type EventUser struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func eventUsers(users []IssueUser) []EventUser {
+	result := []EventUser{}
+	for _, user := range users {
+		result = append(result, EventUser{Name: user.Name, Username: user.UserName, Email: user.Email})
+	}
+	return result
+}
+
+type EventLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type Label struct {
+	Title string `json:"title"`
+}
+
+func labelTitles(labels []Label) []string {
+	titles := []string{}
+	for _, label := range labels {
+		titles = append(titles, label.Title)
+	}
+	return titles
+}
+
+// SkipError the event is valid but nothing should be sent
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return e.Reason
+}
+
+// parseEvent parses the body of the X-Gitlab-Event kind, an unsupported kind returns a nil event
+func parseEvent(kind string, data []byte) (*Event, error) {
+	event := &Event{Kind: kind}
+	switch kind {
+	case "Push Hook":
+		body := &PushBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		if len(body.Commits) == 0 && body.After != zeroSHA {
+			return nil, &SkipError{"no commit"}
+		}
+		event.ObjectKind = "push"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Repository.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref, event.RawRef = shortRef(body.Ref), body.Ref
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.UserName, body.UserUsername, body.UserEmail
+		for _, v := range body.Commits {
+			event.Commits = append(event.Commits, EventCommit{Id: v.Id, Message: v.Message, TimeStamp: v.TimeStamp, Url: v.Url, Author: v.Author.Name})
+		}
+		if len(body.Commits) > 0 {
+			event.URL = body.Commits[len(body.Commits)-1].Url
+		}
+		event.Removed = body.After == zeroSHA
+		if body.TotalCommitsCount > len(body.Commits) {
+			event.MoreCommits = body.TotalCommitsCount - len(body.Commits)
+		}
+		if len(body.Before) > 0 && body.Before != zeroSHA && !event.Removed {
+			event.CompareURL = fmt.Sprintf("%s/-/compare/%s...%s", body.Project.WebUrl, body.Before, body.After)
+		}
+	case "Tag Push Hook":
+		body := &TagPushBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "tag_push"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Repository.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref, event.RawRef, event.Tag = shortRef(body.Ref), body.Ref, true
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.UserName, body.UserUsername, body.UserEmail
+		event.URL = body.Repository.HomePage + strings.Replace(body.Ref, "refs", "", -1)
+	case "Issue Hook":
+		body := &IssuePushBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "issue"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Repository.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.Labels = labelTitles(body.Labels)
+		event.Action, event.Title, event.URL = body.ObjectAttributes.Action, body.ObjectAttributes.Title, body.ObjectAttributes.Url
+	case "Note Hook":
+		body := &CommentPushBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "note"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Repository.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.Note, event.UpdatedAt, event.URL = body.ObjectAttributes.Note, body.ObjectAttributes.UpdatedAt, body.ObjectAttributes.Url
+	case "Merge Request Hook":
+		body := &MRPushBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "merge_request"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Repository.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref = body.ObjectAttributes.TargetBranch
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.Labels = labelTitles(body.Labels)
+		event.Action, event.Title, event.URL = body.ObjectAttributes.Action, body.ObjectAttributes.Title, body.ObjectAttributes.Url
+		event.SourceBranch, event.TargetBranch = body.ObjectAttributes.SourceBranch, body.ObjectAttributes.TargetBranch
+		event.UpdatedAt = body.ObjectAttributes.UpdatedAt
+		if event.Action == "open" {
+			event.Mentions = append(eventUsers(body.Assignees), eventUsers(body.Reviewers)...)
+		}
+	case "Pipeline Hook":
+		body := &PipelineBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		attrs := body.ObjectAttributes
+		if _, ok := pipelineStatusEmoji[attrs.Status]; !ok {
+			return nil, &SkipError{"unknown status: " + attrs.Status}
+		}
+		event.ObjectKind = "pipeline"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Project.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref, event.RawRef, event.Tag = attrs.Ref, attrs.Ref, attrs.Tag
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.URL = fmt.Sprintf("%s/-/pipelines/%d", body.Project.WebUrl, attrs.Id)
+		event.Status, event.CreatedAt, event.FinishedAt, event.Duration = attrs.Status, attrs.CreatedAt, attrs.FinishedAt, attrs.Duration
+		if event.Status == "failed" {
+			event.Mentions = eventUsers([]IssueUser{body.User})
+		}
+	case "Job Hook":
+		body := &JobBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		// only the failures breaking the pipeline are worth a message, the pipeline hook reports the rest
+		if body.BuildStatus != "failed" {
+			return nil, &SkipError{"job status: " + body.BuildStatus}
+		}
+		if body.BuildAllowFailure {
+			return nil, &SkipError{"job allowed to fail"}
+		}
+		event.ObjectKind = "build"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Project.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		if len(event.Project) == 0 {
+			event.Project = body.Repository.Name
+		}
+		event.Ref, event.RawRef, event.Tag = body.Ref, body.Ref, body.Tag
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.URL = fmt.Sprintf("%s/-/jobs/%d", body.Project.WebUrl, body.BuildId)
+		event.Status, event.CreatedAt, event.FinishedAt, event.Duration = body.BuildStatus, body.BuildCreatedAt, body.BuildFinishedAt, int64(body.BuildDuration)
+		event.Job, event.Stage, event.FailureReason = body.BuildName, body.BuildStage, body.BuildFailureReason
+		if body.Runner != nil {
+			event.Runner = body.Runner.Description
+		}
+		event.Mentions = eventUsers([]IssueUser{body.User})
+	case "Deployment Hook":
+		body := &DeploymentBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "deployment"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Project.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref, event.RawRef = body.Ref, body.Ref
+		event.Author, event.AuthorUsername, event.AuthorEmail = body.User.Name, body.User.UserName, body.User.Email
+		event.Status, event.UpdatedAt, event.URL = body.Status, body.StatusChangedAt, body.DeployableUrl
+		event.Environment, event.EnvironmentTier, event.EnvironmentURL = body.Environment, body.EnvironmentTier, body.EnvironmentExternalUrl
+		// the deployed commit
+		event.Commits = []EventCommit{{Id: body.ShortSha, Message: body.CommitTitle, Url: body.CommitUrl, TimeStamp: body.StatusChangedAt, Author: body.User.Name}}
+		if event.Status == "failed" {
+			event.Mentions = eventUsers([]IssueUser{body.User})
+		}
+	case "Release Hook":
+		body := &ReleaseBody{}
+		if err := json.Unmarshal(data, body); err != nil {
+			return nil, err
+		}
+		event.ObjectKind = "release"
+		event.Project, event.ProjectPath, event.ProjectURL = body.Project.Name, body.Project.PathWithNamespace, body.Project.WebUrl
+		event.Ref, event.RawRef, event.Tag = body.Tag, "refs/tags/"+body.Tag, true
+		// the hook has no user, the release commit is the closest
+		event.Author, event.AuthorEmail = body.Commit.Author.Name, body.Commit.Author.Email
+		event.Action, event.Title, event.URL = body.Action, body.Name, body.Url
+		event.CreatedAt, event.UpdatedAt = body.CreatedAt, body.ReleasedAt
+		event.Description = strings.TrimSpace(body.Description)
+		for _, link := range body.Assets.Links {
+			event.Assets = append(event.Assets, EventLink{Name: link.Name, URL: link.Url})
+		}
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Deployed what the deployment of the status did to the environment, as in v1.4.2 deployed to production
+func (e *Event) Deployed() string {
+	switch e.Status {
+	case "success":
+		return "deployed to"
+	case "running":
+		return "deploying to"
+	case "failed":
+		return "failed to deploy to"
+	case "canceled":
+		return "canceled deploying to"
+	}
+	return e.Status + " deploying to"
+}
+
+// RefType branch or tag
+func (e *Event) RefType() string {
+	if e.Tag {
+		return "tag"
+	}
+	return "branch"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type FeishuConfig struct {
+	Webhook string `json:"webhook" yaml:"webhook"`
+	Secret  string `json:"secret" yaml:"secret"`
+}
+
+// Feishu feishu or lark custom bot, events are sent as interactive cards
+type Feishu struct {
+	cfg    *FeishuConfig
+	client *http.Client
+}
+
+type feishuMsg struct {
+	Timestamp string      `json:"timestamp,omitempty"`
+	Sign      string      `json:"sign,omitempty"`
+	MsgType   string      `json:"msg_type"`
+	Content   *feishuText `json:"content,omitempty"`
+	Card      *feishuCard `json:"card,omitempty"`
+}
+
+type feishuText struct {
+	Text string `json:"text"`
+}
+
+type feishuCard struct {
+	Config   feishuCardConfig `json:"config"`
+	Header   feishuHeader     `json:"header"`
+	Elements []interface{}    `json:"elements"`
+}
+
+type feishuCardConfig struct {
+	WideScreenMode bool `json:"wide_screen_mode"`
+}
+
+type feishuHeader struct {
+	Title    feishuTextTag `json:"title"`
+	Template string        `json:"template"`
+}
+
+type feishuTextTag struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+type feishuDiv struct {
+	Tag    string         `json:"tag"`
+	Text   *feishuTextTag `json:"text,omitempty"`
+	Fields []feishuField  `json:"fields,omitempty"`
+}
+
+type feishuField struct {
+	IsShort bool          `json:"is_short"`
+	Text    feishuTextTag `json:"text"`
+}
+
+type feishuAction struct {
+	Tag     string         `json:"tag"`
+	Actions []feishuButton `json:"actions"`
+}
+
+type feishuButton struct {
+	Tag  string        `json:"tag"`
+	Text feishuTextTag `json:"text"`
+	URL  string        `json:"url"`
+	Type string        `json:"type"`
+}
+
+type feishuResp struct {
+	Code          int64  `json:"code"`
+	Msg           string `json:"msg"`
+	StatusCode    int64  `json:"StatusCode"`
+	StatusMessage string `json:"StatusMessage"`
+}
+
+// feishuColors the header template of each pipeline status
+var feishuColors = map[string]string{
+	"success":  "green",
+	"failed":   "red",
+	"running":  "blue",
+	"pending":  "yellow",
+	"canceled": "grey",
+}
+
+func NewFeishu(cfg *FeishuConfig) (*Feishu, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("feishu.webhook is empty")
+	}
+	return &Feishu{cfg: cfg, client: NewClient()}, nil
+}
+
+// sign returns timestamp and sign, sign is base64(HmacSHA256(timestamp+"\n"+secret, ""))
+func (f *Feishu) sign(now time.Time) (string, string) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+f.cfg.Secret))
+	return timestamp, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func buildFeishuCard(e *Event, body string) *feishuCard {
+	color, ok := feishuColors[e.Status]
+	if !ok {
+		color = "blue"
+	}
+	card := &feishuCard{
+		Config: feishuCardConfig{WideScreenMode: true},
+		Header: feishuHeader{Title: feishuTextTag{Tag: "plain_text", Content: e.Project + " · " + e.Summary()}, Template: color},
+	}
+	fields := []feishuField{}
+	addField := func(name, value string) {
+		if len(value) > 0 {
+			fields = append(fields, feishuField{IsShort: true, Text: feishuTextTag{Tag: "lark_md", Content: "**" + name + "**\n" + value}})
+		}
+	}
+	if len(e.SourceBranch) > 0 {
+		addField(e.tr("Branch"), e.SourceBranch+" → "+e.TargetBranch)
+	} else if e.Tag {
+		addField(e.tr("Tag"), e.Ref)
+	} else {
+		addField(e.tr("Branch"), e.Ref)
+	}
+	addField(e.tr("Author"), e.Author)
+	addField(e.tr("Status"), e.tr(e.Status))
+	addField(e.tr("Duration"), formatDuration(e.Duration))
+	if len(fields) > 0 {
+		card.Elements = append(card.Elements, feishuDiv{Tag: "div", Fields: fields})
+	}
+	// the fields already hold everything of a pipeline
+	if len(body) > 0 && e.ObjectKind != "pipeline" {
+		card.Elements = append(card.Elements, feishuDiv{Tag: "div", Text: &feishuTextTag{Tag: "lark_md", Content: body}})
+	}
+	if len(e.URL) > 0 {
+		card.Elements = append(card.Elements, feishuAction{Tag: "action", Actions: []feishuButton{{Tag: "button", Text: feishuTextTag{Tag: "plain_text", Content: actionText(e)}, URL: e.URL, Type: "primary"}}})
+	}
+	return card
+}
+
+func (f *Feishu) Markup() *Markup {
+	return SimpleMarkup
+}
+
+// Limit feishu rejects requests over 30KB
+func (f *Feishu) Limit(msg *Message) int {
+	return 30000
+}
+
+func (f *Feishu) Send(msg *Message) (*WxResp, error) {
+	body := &feishuMsg{MsgType: "text", Content: &feishuText{Text: msg.Content}}
+	if msg.Event != nil && msg.Markdown {
+		body = &feishuMsg{MsgType: "interactive", Card: buildFeishuCard(msg.Event, msg.body(SimpleMarkup))}
+	}
+	if len(f.cfg.Secret) > 0 {
+		body.Timestamp, body.Sign = f.sign(time.Now())
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Post(f.cfg.Webhook, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request feishu bot err: %s", err)
+	}
+	defer resp.Body.Close()
+	feishuResp := &feishuResp{}
+	if err = json.NewDecoder(resp.Body).Decode(feishuResp); err != nil {
+		return nil, fmt.Errorf("Decode feishu response err: %s, status %d", err, resp.StatusCode)
+	}
+	if feishuResp.Code == 0 && len(feishuResp.Msg) == 0 {
+		return &WxResp{ErrCode: feishuResp.StatusCode, ErrMsg: feishuResp.StatusMessage}, nil
+	}
+	return &WxResp{ErrCode: feishuResp.Code, ErrMsg: feishuResp.Msg}, nil
+}
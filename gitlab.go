@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -103,32 +101,44 @@ type WxResp struct {
 
 // Push events
 type PushBody struct {
-	ObjectKind string     `json:"object_kind"`
-	Ref        string     `json:"ref"`
-	Commits    []Commit   `json:commits`
-	Repository Repository `json:"repository"`
-	After      string     `json:"after"`
-	UserName   string     `json:"user_name"`
+	ObjectKind   string     `json:"object_kind"`
+	Ref          string     `json:"ref"`
+	Commits      []Commit   `json:"commits"`
+	Repository   Repository `json:"repository"`
+	Project      Project    `json:"project"`
+	Before       string     `json:"before"`
+	After        string     `json:"after"`
+	UserName     string     `json:"user_name"`
+	UserUsername string     `json:"user_username"`
+	UserEmail    string     `json:"user_email"`
+	// TotalCommitsCount gitlab only sends the latest 20 commits
+	TotalCommitsCount int `json:"total_commits_count"`
 }
 
 // TagPushBody Tag events
 type TagPushBody struct {
-	UserName   string     `json:"user_name"`
-	Ref        string     `json:"ref"`
-	Repository Repository `json:"repository"`
+	UserName     string     `json:"user_name"`
+	UserUsername string     `json:"user_username"`
+	UserEmail    string     `json:"user_email"`
+	Ref          string     `json:"ref"`
+	Repository   Repository `json:"repository"`
+	Project      Project    `json:"project"`
 }
 
 // IssuePushBody Issues events
 type IssuePushBody struct {
 	User             IssueUser   `json:"user"`
 	Repository       Repository  `json:"repository"`
+	Project          Project     `json:"project"`
 	ObjectAttributes IssueObject `json:"object_attributes"`
+	Labels           []Label     `json:"labels"`
 }
 
 // CommentPushBody comment
 type CommentPushBody struct {
 	User             IssueUser     `json:"user"`
 	Repository       Repository    `json:"repository"`
+	Project          Project       `json:"project"`
 	ObjectAttributes CommentObject `json:"object_attributes"`
 }
 
@@ -141,9 +151,13 @@ type CommentObject struct {
 
 // MRPushBody
 type MRPushBody struct {
-	User             IssueUser  `json:"user"`
-	Repository       Repository `json:"repository"`
-	ObjectAttributes MRObjects  `json:"object_attributes"`
+	User             IssueUser   `json:"user"`
+	Repository       Repository  `json:"repository"`
+	Project          Project     `json:"project"`
+	ObjectAttributes MRObjects   `json:"object_attributes"`
+	Labels           []Label     `json:"labels"`
+	Assignees        []IssueUser `json:"assignees"`
+	Reviewers        []IssueUser `json:"reviewers"`
 }
 
 // PipelineBody
@@ -163,8 +177,72 @@ type PipelineObject struct {
 	Tag        bool   `json:"tag"`
 }
 
+// JobBody Job events
+type JobBody struct {
+	Ref                string     `json:"ref"`
+	Tag                bool       `json:"tag"`
+	BuildId            int64      `json:"build_id"`
+	BuildName          string     `json:"build_name"`
+	BuildStage         string     `json:"build_stage"`
+	BuildStatus        string     `json:"build_status"`
+	BuildCreatedAt     string     `json:"build_created_at"`
+	BuildFinishedAt    string     `json:"build_finished_at"`
+	BuildDuration      float64    `json:"build_duration"`
+	BuildAllowFailure  bool       `json:"build_allow_failure"`
+	BuildFailureReason string     `json:"build_failure_reason"`
+	Runner             *JobRunner `json:"runner"`
+	User               IssueUser  `json:"user"`
+	Repository         Repository `json:"repository"`
+	Project            Project    `json:"project"`
+}
+
+// DeploymentBody Deployment events
+type DeploymentBody struct {
+	Status                 string    `json:"status"`
+	StatusChangedAt        string    `json:"status_changed_at"`
+	DeployableUrl          string    `json:"deployable_url"`
+	Environment            string    `json:"environment"`
+	EnvironmentTier        string    `json:"environment_tier"`
+	EnvironmentExternalUrl string    `json:"environment_external_url"`
+	ShortSha               string    `json:"short_sha"`
+	CommitUrl              string    `json:"commit_url"`
+	CommitTitle            string    `json:"commit_title"`
+	Ref                    string    `json:"ref"`
+	User                   IssueUser `json:"user"`
+	Project                Project   `json:"project"`
+}
+
+// ReleaseBody Release events
+type ReleaseBody struct {
+	Action      string        `json:"action"`
+	Name        string        `json:"name"`
+	Tag         string        `json:"tag"`
+	Description string        `json:"description"`
+	Url         string        `json:"url"`
+	CreatedAt   string        `json:"created_at"`
+	ReleasedAt  string        `json:"released_at"`
+	Assets      ReleaseAssets `json:"assets"`
+	Commit      Commit        `json:"commit"`
+	Project     Project       `json:"project"`
+}
+
+type ReleaseAssets struct {
+	Links []ReleaseLink `json:"links"`
+}
+
+type ReleaseLink struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+type JobRunner struct {
+	Id          int64  `json:"id"`
+	Description string `json:"description"`
+}
+
 type MRObjects struct {
 	Id           int64  `json:"id"`
+	Title        string `json:"title"`
 	TargetBranch string `json:"target_branch"`
 	SourceBranch string `json:"source_branch"`
 	UpdatedAt    string `json:"updated_at"`
@@ -175,12 +253,13 @@ type MRObjects struct {
 type IssueUser struct {
 	Name     string `json:"name"`
 	UserName string `json:"username"`
+	Email    string `json:"email"`
 }
 
 type IssueObject struct {
 	Id     int64  `json:"id"`
 	Title  string `json:"title"`
-	Url    string `jso:"url"`
+	Url    string `json:"url"`
 	Action string `json:"action"`
 }
 
@@ -204,131 +283,95 @@ type Repository struct {
 }
 
 type Project struct {
-	Name      string `json:"name"`
-	WebUrl    string `json:"web_url"`
-	GitSSHUrl string `json:"git_ssh_url"`
-}
-
-func bindJson(ctx *gin.Context, m interface{}) error {
-	err := ctx.BindJSON(m)
-	if err != nil {
-		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("Parse gitlab requset body error: %s", err)})
-		return err
-	}
-	return nil
-}
-
-func buildMsg(content string, markdown bool) string {
-	if markdown {
-		return fmt.Sprintf(`{"msgtype": "markdown", "markdown":{"content": "%s"}}`, content)
-	}
-	return fmt.Sprintf(`{"msgtype": "text", "text":{"content": "%s"}}`, content)
+	Name              string `json:"name"`
+	WebUrl            string `json:"web_url"`
+	GitSSHUrl         string `json:"git_ssh_url"`
+	PathWithNamespace string `json:"path_with_namespace"`
 }
 
 func TransmitRobot(ctx *gin.Context) {
-	key := ctx.GetHeader("X-Gitlab-Token")
-	if len(key) == 0 {
+	token := ctx.GetHeader("X-Gitlab-Token")
+	if len(token) == 0 {
 		ctx.Render(403, render.Data{ContentType: "application/json", Data: []byte("X-Gitlab-Token is empty")})
 		return
 	}
-	requestUrl := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=%s", key)
-	var resp *http.Response
-	var wxErr error
-	var content string
-	pushEvent := ctx.GetHeader("X-Gitlab-Event")
-	if pushEvent == "Push Hook" {
-		pushBody := &PushBody{}
-		if err := bindJson(ctx, pushBody); err != nil {
-			return
-		}
-		if len(pushBody.Commits) == 0 && pushBody.After != "0000000000000000000000000000000000000000" {
-			ctx.JSON(200, &WxResp{ErrCode: 0, ErrMsg: "no commit"})
-			return
-		}
-		content = "# " + pushBody.Repository.Name + "\n"
-		content += "### On branch `" + pushBody.Ref + "`\n"
-		for _, v := range pushBody.Commits {
-			content += fmt.Sprintf("%s push a commit [%s](%s)  %s", v.Author.Name, strings.ReplaceAll(v.Message, "\n", ""), v.Url, v.TimeStamp) + "\n"
-		}
-		if pushBody.After == "0000000000000000000000000000000000000000" {
-			content += fmt.Sprintf("%s `remove` it", pushBody.UserName)
-		}
-	} else if pushEvent == "Tag Push Hook" {
-		tagPushBody := &TagPushBody{}
-		if err := bindJson(ctx, tagPushBody); err != nil {
-			return
-		}
-		content = "# " + tagPushBody.Repository.Name + "\n"
-		content += fmt.Sprintf("%s push a tag: [%s](%s)", tagPushBody.UserName, tagPushBody.Ref, tagPushBody.Repository.HomePage+strings.Replace(tagPushBody.Ref, "refs", "", -1))
-	} else if pushEvent == "Issue Hook" {
-		issueBody := &IssuePushBody{}
-		if err := bindJson(ctx, issueBody); err != nil {
-			return
-		}
-		content = "# " + issueBody.Repository.Name + "\n"
-		content += fmt.Sprintf("%s %s a issue [%s](%s)", issueBody.User.Name, issueBody.ObjectAttributes.Action, issueBody.ObjectAttributes.Title, issueBody.ObjectAttributes.Url)
-	} else if pushEvent == "Note Hook" {
-		commentBody := &CommentPushBody{}
-		if err := bindJson(ctx, commentBody); err != nil {
-			return
-		}
-		content = "# " + commentBody.Repository.Name + "\n"
-		content += fmt.Sprintf("%s leave a comment: %s  %s \n[Detail>>](%s)", commentBody.User.Name, commentBody.ObjectAttributes.Note, commentBody.ObjectAttributes.UpdatedAt, commentBody.ObjectAttributes.Url)
-	} else if pushEvent == "Merge Request Hook" {
-		mrBody := &MRPushBody{}
-		if err := bindJson(ctx, mrBody); err != nil {
+	cfg := configStore.Get()
+	secret, ok := cfg.lookupSecret(token)
+	targets := []Target{}
+	if !ok {
+		if !cfg.Legacy {
+			ctx.JSON(403, WxResp{ErrCode: 403, ErrMsg: "X-Gitlab-Token is invalid"})
 			return
 		}
-		content = "# " + mrBody.Repository.Name + "\n"
-		content += fmt.Sprintf("%s `%s` a merge request from `%s` to `%s` \n[Detail>>](%s)", mrBody.User.Name, mrBody.ObjectAttributes.Action, mrBody.ObjectAttributes.SourceBranch, mrBody.ObjectAttributes.TargetBranch, mrBody.ObjectAttributes.Url)
-	} else if pushEvent == "Pipeline Hook" {
-		pipelineBody := &PipelineBody{}
-		if err := bindJson(ctx, pipelineBody); err != nil {
+		secret = &SecretConfig{Name: legacyDestination}
+		targets = append(targets, legacyTarget(token))
+	}
+	metrics.inc(&metrics.Webhooks)
+	// gitlab sends the event again with the same id when it got no answer in time
+	id := ctx.GetHeader("Idempotency-Key")
+	if len(id) == 0 {
+		id = ctx.GetHeader("X-Gitlab-Event-UUID")
+	}
+	if len(id) > 0 {
+		id = secret.Name + "/" + id
+		if !dedup.Add(id) {
+			metrics.inc(&metrics.DedupHits)
+			ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: "duplicate"})
 			return
 		}
-		content = "# " + pipelineBody.Project.Name + "\n"
-		branch := "branch"
-		if pipelineBody.ObjectAttributes.Tag {
-			branch = "tag"
-		}
-		content += fmt.Sprintf("### Pipeline on %s `%s`\n", branch, pipelineBody.ObjectAttributes.Ref)
-		status := ""
-		if pipelineBody.ObjectAttributes.Status == "failed" {
-			status = "🐛"
-		} else if pipelineBody.ObjectAttributes.Status == "running" {
-			status = "🚀"
-		} else if pipelineBody.ObjectAttributes.Status == "success" {
-			status = "✅"
-		} else if pipelineBody.ObjectAttributes.Status == "pending" {
-			status = "🔒"
-		}
-		if len(status) == 0 {
-			ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: "unknown status: " + pipelineBody.ObjectAttributes.Status})
+	}
+	data, err := ctx.GetRawData()
+	if err != nil {
+		dedup.Remove(id)
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("Read gitlab requset body error: %s", err)})
+		return
+	}
+	event, err := parseEvent(ctx.GetHeader("X-Gitlab-Event"), data)
+	if err != nil {
+		if skip, ok := err.(*SkipError); ok {
+			ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: skip.Reason})
 			return
 		}
-		content += "`Status`: " + status + "\n"
-		content += fmt.Sprintf("`Start at`: %s\n", pipelineBody.ObjectAttributes.CreatedAt)
-		if len(pipelineBody.ObjectAttributes.FinishedAt) > 0 {
-			content += fmt.Sprintf("`Finish at`: %s\n", pipelineBody.ObjectAttributes.FinishedAt)
-		}
-		if pipelineBody.ObjectAttributes.Duration > 0 {
-			content += fmt.Sprintf("`Duration`: %ds", pipelineBody.ObjectAttributes.Duration)
-		}
+		dedup.Remove(id)
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("Parse gitlab requset body error: %s", err)})
+		return
+	}
+	if event == nil {
+		ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: "no content"})
+		return
 	}
-	if len(content) == 0 {
+	event.UUID = ctx.GetHeader("X-Gitlab-Event-UUID")
+	if len(renderEvent(event, MarkdownMarkup)) == 0 {
 		ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: "no content"})
 		return
 	}
-	content = trans2Emoji(content)
-	data := []byte(buildMsg(content, true))
-	client := NewClient()
-	resp, wxErr = client.Post(requestUrl, "application/json", bytes.NewBuffer(data))
-	defer resp.Body.Close()
-	if wxErr != nil {
-		ctx.JSON(500, WxResp{ErrCode: 500, ErrMsg: fmt.Sprintf("Request wexin robot err: %s ", wxErr)})
+	// a legacy caller only reaches the wecom key of its token, never the routes
+	if ok {
+		targets = append(targets, cfg.Targets(secret, event)...)
+	}
+	if len(targets) == 0 {
+		ctx.JSON(200, WxResp{ErrCode: 0, ErrMsg: "no destination"})
+		return
+	}
+	mentions := cfg.mentions(event)
+	// gitlab is answered once the messages are queued, they are delivered by the workers
+	resp := &TransmitResp{WxResp: WxResp{ErrCode: 0, ErrMsg: "queued"}, Results: []Result{}}
+	jobs := []*Job{}
+	for _, target := range targets {
+		jobs = append(jobs, &Job{Target: target, Messages: target.messages(event, mentions)})
+	}
+	queued := queue.Push(jobs...)
+	if !queued {
+		resp.ErrCode, resp.ErrMsg = 503, "queue is full"
+	}
+	for _, target := range targets {
+		resp.Results = append(resp.Results, Result{Destination: target.Name, ErrCode: resp.ErrCode, ErrMsg: resp.ErrMsg})
+	}
+	if !queued {
+		// nothing is queued, the event gitlab sends again is delivered to every destination once
+		dedup.Remove(id)
+		ctx.JSON(503, resp)
 		return
 	}
-	wxResp := &WxResp{}
-	json.NewDecoder(resp.Body).Decode(wxResp)
-	ctx.JSON(200, wxResp)
+	ctx.JSON(200, resp)
 }
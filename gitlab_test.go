@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveWebhook sets the globals of the handler to cfg, a queue without workers and an empty dedup,
+// the returned func posts the push sample with the token and answers the response and the jobs queued
+func serveWebhook(t *testing.T, cfg *Config) func(token string) (*httptest.ResponseRecorder, []*Job) {
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	configStore = &ConfigStore{cfg: cfg}
+	queue = NewQueue(10, 0, 0, nil)
+	dedup = NewDedup(100, time.Hour)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/", TransmitRobot)
+	return func(token string) (*httptest.ResponseRecorder, []*Job) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(samplePayloads["Push Hook"]))
+		req.Header.Set("X-Gitlab-Event", "Push Hook")
+		req.Header.Set("X-Gitlab-Event-UUID", "event-1")
+		if len(token) > 0 {
+			req.Header.Set("X-Gitlab-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		jobs := []*Job{}
+		for len(queue.jobs) > 0 {
+			jobs = append(jobs, <-queue.jobs)
+		}
+		return w, jobs
+	}
+}
+
+// routedConfig a secret sending to wecom and a route without secrets sending every event to slack
+func routedConfig(legacy bool) *Config {
+	return &Config{
+		Legacy:  legacy,
+		Secrets: []*SecretConfig{{Name: "team", Token: "s3cret", Destinations: []string{"wecom"}}},
+		Destinations: map[string]*DestinationConfig{
+			"wecom": {WeCom: &WeComConfig{Key: "key"}},
+			"slack": {Slack: &SlackConfig{Webhook: "http://127.0.0.1:1/slack"}},
+		},
+		Routes: []*Route{{Destinations: []string{"slack"}}},
+	}
+}
+
+func jobNames(jobs []*Job) []string {
+	names := []string{}
+	for _, job := range jobs {
+		names = append(names, job.Target.Name)
+	}
+	return names
+}
+
+func TestLegacyCallerSkipsRoutes(t *testing.T) {
+	post := serveWebhook(t, routedConfig(true))
+	w, jobs := post("some-wecom-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if names := jobNames(jobs); len(names) != 1 || names[0] != legacyDestination {
+		t.Fatalf("queued %v, want only the legacy wecom key", names)
+	}
+	wecom := jobs[0].Target.Notifier.(*WeCom)
+	if wecom.cfg.Key != "some-wecom-key" {
+		t.Errorf("legacy key %q, want the token", wecom.cfg.Key)
+	}
+}
+
+func TestEventQueuedToAllTargetsOrNone(t *testing.T) {
+	defer func(timeout time.Duration) { pushTimeout = timeout }(pushTimeout)
+	pushTimeout = 50 * time.Millisecond
+	post := serveWebhook(t, routedConfig(false))
+	queue = NewQueue(2, 0, 0, nil)
+	// another event holds one of the two slots, the two targets of the event do not fit
+	queue.slots <- struct{}{}
+	w, jobs := post("s3cret")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+	if len(jobs) > 0 || queue.Pending() != 1 {
+		t.Fatalf("queued %v with %d pending, want nothing queued", jobNames(jobs), queue.Pending())
+	}
+	<-queue.slots
+	// gitlab sends the event again, it is not a duplicate and goes to both targets once
+	w, jobs = post("s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if names := jobNames(jobs); strings.Join(names, ",") != "wecom,slack" {
+		t.Fatalf("queued %v, want both targets", names)
+	}
+	if w, jobs = post("s3cret"); len(jobs) > 0 || !strings.Contains(w.Body.String(), "duplicate") {
+		t.Fatalf("redelivery queued %v: %s", jobNames(jobs), w.Body)
+	}
+}
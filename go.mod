@@ -2,7 +2,10 @@ module github.com/bujnlc8/gitlabot
 
 go 1.17
 
-require github.com/gin-gonic/gin v1.7.4
+require (
+	github.com/gin-gonic/gin v1.7.4
+	gopkg.in/yaml.v2 v2.2.8
+)
 
 require (
 	github.com/gin-contrib/sse v0.1.0 // indirect
@@ -18,5 +21,4 @@ require (
 	github.com/ugorji/go/codec v1.1.7 // indirect
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
 	golang.org/x/sys v0.0.0-20200116001909-b77594299b42 // indirect
-	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
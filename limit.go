@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// messages renders the event for the target, the messages the backend cannot mention in are followed by one that does
+func (t Target) messages(event *Event, mentions []*UserConfig) []*Message {
+	if event.Locale != t.Locale {
+		localized := *event
+		localized.Locale = t.Locale
+		event = &localized
+	}
+	msgs := t.render(event, mentions)
+	follower, ok := t.Notifier.(Follower)
+	if !ok {
+		return msgs
+	}
+	result := []*Message{}
+	for _, msg := range msgs {
+		result = append(result, msg)
+		if followUp := follower.FollowUp(msg); followUp != nil {
+			msg.Mentions = nil
+			result = append(result, followUp)
+		}
+	}
+	return result
+}
+
+// render renders the event within the limit of the backend,
+// an oversized message is truncated or, when the route asks for it, split into ordered parts
+func (t Target) render(event *Event, mentions []*UserConfig) []*Message {
+	m := t.Notifier.Markup()
+	msg := &Message{Title: event.Project, URL: event.URL, Markdown: t.Template != TemplateText, Card: t.Template == TemplateCard, Event: event, Recipients: t.Recipients, Mentions: mentions, Renderer: t.Renderer}
+	limit := t.Notifier.Limit(msg)
+	msg.Content = t.Renderer.Render(event, m)
+	if limit <= 0 || len(msg.Content) <= limit {
+		return []*Message{msg}
+	}
+	if !t.Split {
+		msg.Event, msg.Content = fitEvent(event, func(e *Event) string { return t.Renderer.Render(e, m) }, limit)
+		return []*Message{msg}
+	}
+	parts := splitContent(msg.Content, limit)
+	msgs := []*Message{}
+	for i, content := range parts {
+		// the parts are sent as plain content, the backends would render the whole event again
+		part := *msg
+		part.Event, part.Content = nil, content
+		if i < len(parts)-1 {
+			part.Mentions = nil
+		}
+		msgs = append(msgs, &part)
+	}
+	return msgs
+}
+
+// fitEvent drops the latest commits, then shortens the note and the release notes, until the rendered event fits in limit bytes,
+// the returned event is a copy when it is trimmed
+func fitEvent(e *Event, render func(e *Event) string, limit int) (*Event, string) {
+	content := render(e)
+	if len(content) <= limit {
+		return e, content
+	}
+	fitted := *e
+	tooLarge := func() bool {
+		content = render(&fitted)
+		return len(content) > limit
+	}
+	if len(e.Commits) > 0 {
+		keep := func(n int) {
+			fitted.Commits, fitted.MoreCommits = e.Commits[:n], e.MoreCommits+len(e.Commits)-n
+		}
+		// the first count of commits that is too large, the one before fits
+		n := sort.Search(len(e.Commits)+1, func(n int) bool {
+			keep(n)
+			return tooLarge()
+		})
+		if n > 0 {
+			n--
+		}
+		keep(n)
+	}
+	for _, field := range []*string{&fitted.Note, &fitted.Description} {
+		text := []rune(*field)
+		if len(text) == 0 || !tooLarge() {
+			continue
+		}
+		n := sort.Search(len(text)+1, func(n int) bool {
+			*field = string(text[:n]) + "…"
+			return tooLarge()
+		})
+		if n > 0 {
+			n--
+		}
+		*field = string(text[:n]) + "…"
+	}
+	if tooLarge() {
+		content = truncateBytes(content, limit)
+	}
+	return &fitted, content
+}
+
+// truncateBytes cuts s to limit bytes, at the last line break when there is one so that no markup is left open
+func truncateBytes(s string, limit int) string {
+	const ellipsis = "…"
+	if len(s) <= limit {
+		return s
+	}
+	if limit < len(ellipsis) {
+		return ""
+	}
+	cut := limit - len(ellipsis)
+	if i := strings.LastIndex(s[:cut], "\n"); i > 0 {
+		return s[:i+1] + ellipsis
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
+
+// splitContent splits s at line breaks into parts of at most limit bytes, numbered as (1/n),
+// a line longer than a part is split at rune boundaries and the heading is never sent on its own
+func splitContent(s string, limit int) []string {
+	// room for the part number
+	const reserved = 16
+	size := limit - reserved
+	if size < utf8.UTFMax {
+		size = utf8.UTFMax
+	}
+	parts := []string{}
+	part := ""
+	// heading the part holds the first line only
+	heading := false
+	for i, line := range strings.SplitAfter(s, "\n") {
+		if len(part)+len(line) > size && len(part) > 0 && len(line) <= size && !heading {
+			parts = append(parts, part)
+			part = ""
+		}
+		// the line fills the rest of the part it starts in
+		for len(part)+len(line) > size {
+			cut := size - len(part)
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			part += line[:cut]
+			line = line[cut:]
+			parts = append(parts, part)
+			part = ""
+		}
+		part += line
+		heading = i == 0
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	for i, part := range parts {
+		parts[i] = strings.TrimRight(part, "\n") + fmt.Sprintf("\n(%d/%d)", i+1, len(parts))
+	}
+	return parts
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var partNumber = regexp.MustCompile(`\n\(\d+/\d+\)$`)
+
+func TestSplitLongLines(t *testing.T) {
+	const limit = 200
+	heading := "# project\n"
+	for _, s := range []string{
+		heading + strings.Repeat("一行很长的评论 ", 100),
+		heading + strings.Repeat("short line\n", 30) + strings.Repeat("x", 1000) + "\nlast",
+		heading + strings.Repeat("y", limit-20) + "\n" + strings.Repeat("z", limit-20),
+	} {
+		parts := splitContent(s, limit)
+		joined := ""
+		for i, part := range parts {
+			if len(part) > limit {
+				t.Fatalf("part %d of %d bytes, want at most %d", i, len(part), limit)
+			}
+			body := partNumber.ReplaceAllString(part, "")
+			if body == strings.TrimRight(heading, "\n") {
+				t.Fatalf("part %d is the heading only", i)
+			}
+			joined += body
+		}
+		if strings.ReplaceAll(joined, "\n", "") != strings.ReplaceAll(s, "\n", "") {
+			t.Fatalf("split lost content:\n%q\n%q", joined, s)
+		}
+	}
+}
+
+func TestSplitNote(t *testing.T) {
+	wecom, _ := NewWeCom(&WeComConfig{Key: "key"})
+	event := sampleEvent("note")
+	event.Note = strings.Repeat("a long note ", 1000)
+	target := Target{Name: "wecom", Notifier: wecom, Template: TemplateMarkdown, Split: true, Renderer: defaultTemplate}
+	msgs := target.messages(event, nil)
+	joined := ""
+	for _, msg := range msgs {
+		if len(msg.Content) > 4096 {
+			t.Fatalf("part of %d bytes", len(msg.Content))
+		}
+		joined += partNumber.ReplaceAllString(msg.Content, "")
+	}
+	if !strings.Contains(strings.ReplaceAll(joined, "\n", ""), event.Note) {
+		t.Fatal("the note is not sent whole")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import "fmt"
+
+// catalogs the words the builtin templates translate with tr, missing words are kept as is
+var catalogs = map[string]map[string]string{
+	"en-US": {
+		"open":       "opened",
+		"close":      "closed",
+		"reopen":     "reopened",
+		"update":     "updated",
+		"merge":      "merged",
+		"approved":   "approved",
+		"approval":   "approved",
+		"unapproved": "unapproved",
+		"unapproval": "unapproved",
+		"create":     "published",
+		"delete":     "deleted",
+		// the failure reasons of the jobs
+		"script_failure":             "script failure",
+		"runner_system_failure":      "runner system failure",
+		"stuck_or_timeout_failure":   "stuck or timed out",
+		"job_execution_timeout":      "execution timed out",
+		"api_failure":                "api failure",
+		"missing_dependency_failure": "missing dependency",
+		"unknown_failure":            "unknown failure",
+	},
+	"zh-CN": {
+		"open":       "创建了",
+		"close":      "关闭了",
+		"reopen":     "重新打开了",
+		"update":     "更新了",
+		"merge":      "合并了",
+		"approved":   "批准了",
+		"approval":   "批准了",
+		"unapproved": "取消批准了",
+		"unapproval": "取消批准了",
+		"create":     "发布了",
+		"delete":     "删除了",
+		"failed":     "失败",
+		"running":    "运行中",
+		"success":    "成功",
+		"pending":    "等待中",
+		"canceled":   "已取消",
+		"branch":     "分支",
+		"tag":        "标签",
+		// the failure reasons of the jobs
+		"script_failure":             "脚本执行失败",
+		"runner_system_failure":      "Runner系统故障",
+		"stuck_or_timeout_failure":   "卡住或超时",
+		"job_execution_timeout":      "执行超时",
+		"api_failure":                "API故障",
+		"missing_dependency_failure": "缺少依赖",
+		"unknown_failure":            "未知错误",
+		// the deployments, as in alice 部署了 v1.4.2 → production
+		"deploy_success":  "部署了",
+		"deploy_running":  "正在部署",
+		"deploy_failed":   "部署失败",
+		"deploy_canceled": "取消了部署",
+		// the summaries, the args of the formats are reordered with %[n]s
+		"%s removed branch %s":           "%[1]s 删除了分支 %[2]s",
+		"%s pushed %d commits to %s":     "%[1]s 推送了 %[2]d 个提交到 %[3]s",
+		"%s pushed tag %s":               "%[1]s 推送了标签 %[2]s",
+		"%s %s issue %s":                 "%[1]s %[2]s议题 %[3]s",
+		"%s left a comment":              "%[1]s 发表了评论",
+		"%s %s merge request %s":         "%[1]s %[2]s合并请求 %[3]s",
+		"Pipeline %s on %s %s":           "%[2]s %[3]s 的流水线%[1]s",
+		"Job %s %s in stage %s on %s %s": "%[4]s %[5]s 的任务 %[1]s %[2]s, 阶段 %[3]s",
+		"%s %s %s by %s":                 "%[4]s %[2]s %[1]s → %[3]s",
+		"Release %s %s":                  "%[2]s版本 %[1]s",
+		"Pipeline on %s %s":              "%[1]s %[2]s 的流水线",
+		"Job %s on %s %s":                "%[2]s %[3]s 的任务 %[1]s",
+		"%s %s %s":                       "%[2]s %[1]s → %[3]s",
+		// the labels of the cards and fields
+		"Project":          "项目",
+		"Ref":              "引用",
+		"Branch":           "分支",
+		"Tag":              "标签",
+		"Author":           "作者",
+		"Status":           "状态",
+		"Duration":         "耗时",
+		"Finish at":        "结束时间",
+		"Stage":            "阶段",
+		"Reason":           "原因",
+		"Environment":      "环境",
+		"Tier":             "环境层级",
+		"Commit":           "提交",
+		"Labels":           "标记",
+		"Deployment":       "部署",
+		"Merge request":    "合并请求",
+		"Open environment": "访问环境",
+		"View MR":          "查看合并请求",
+		"View pipeline":    "查看流水线",
+		"View job":         "查看任务",
+		"View deployment":  "查看部署",
+		"View release":     "查看版本",
+		"Detail":           "查看详情",
+	},
+}
+
+var enTemplates = map[string]string{
+	"push": `{{if .Removed}}{{escape .Author}} deleted {{.RefType}} {{code (escape .Ref)}}{{else}}{{heading 3 (print (escape .Author) " pushed to " (code (escape .Ref)))}}
+{{range .Commits}}{{link (escape (firstline .Message)) .Url}} by {{escape .Author}}  {{escape .TimeStamp}}
+{{end}}{{if .MoreCommits}}{{$more := escape (printf "... and %d more commits" .MoreCommits)}}{{if .CompareURL}}{{link $more .CompareURL}}{{else}}{{$more}}{{end}}{{end}}{{end}}`,
+	"tag_push": `{{escape .Author}} pushed tag {{link (escape .Ref) .URL}}`,
+	"issue":    `{{escape .Author}} {{tr .Action}} issue {{link (escape .Title) .URL}}`,
+	"note": `{{escape .Author}} commented: {{escape .Note}}  {{escape .UpdatedAt}}
+{{link "View comment" .URL}}`,
+	"merge_request": `{{escape .Author}} {{tr .Action}} merge request {{link (escape .Title) .URL}}
+{{code (escape .SourceBranch)}} → {{code (escape .TargetBranch)}}`,
+	"pipeline": `{{heading 3 (print "Pipeline " (tr .Status) " on " .RefType " " (code (escape .Ref)))}}
+{{code "Status"}}: {{status .Status}} {{tr .Status}}
+{{code "Started"}}: {{escape .CreatedAt}}
+{{if .FinishedAt}}{{code "Finished"}}: {{escape .FinishedAt}}
+{{end}}{{if gt .Duration 0}}{{code "Duration"}}: {{duration .Duration}}{{end}}`,
+	"build": `{{heading 3 (print "Job " (code (escape .Job)) " " (tr .Status) " on " .RefType " " (code (escape .Ref)))}}
+{{code "Stage"}}: {{escape .Stage}}
+{{if .FailureReason}}{{code "Reason"}}: {{status .Status}} {{tr .FailureReason}}
+{{end}}{{if .Runner}}{{code "Runner"}}: {{escape .Runner}}
+{{end}}{{if gt .Duration 0}}{{code "Duration"}}: {{duration .Duration}}
+{{end}}{{link "View job" .URL}}`,
+	"deployment": `{{heading 3 (print (status .Status) " " (code (escape .Ref)) " " .Deployed " " (code (escape .Environment)) " by " (escape .Author))}}
+{{range .Commits}}{{link (escape .Id) .Url}} {{escape (firstline .Message)}}
+{{end}}{{if .EnvironmentURL}}{{link "Open environment" .EnvironmentURL}} · {{end}}{{link "View deployment" .URL}}`,
+	"release": `{{heading 3 (print "Release " (link (escape .Title) .URL) " " (tr .Action))}}
+{{code "Tag"}}: {{escape .Ref}}
+{{if .Description}}{{escape (excerpt 500 .Description)}}
+{{end}}{{if .Assets}}{{code "Assets"}}: {{range $i, $asset := .Assets}}{{if $i}} · {{end}}{{link (escape $asset.Name) $asset.URL}}{{end}}{{end}}`,
+}
+
+var zhTemplates = map[string]string{
+	"push": `{{if .Removed}}{{escape .Author}} 删除了{{tr .RefType}} {{code (escape .Ref)}}{{else}}{{heading 3 (print (escape .Author) " 推送到" (tr .RefType) " " (code (escape .Ref)))}}
+{{range .Commits}}{{link (escape (firstline .Message)) .Url}} {{escape .Author}}  {{escape .TimeStamp}}
+{{end}}{{if .MoreCommits}}{{$more := escape (printf "... 还有 %d 个提交" .MoreCommits)}}{{if .CompareURL}}{{link $more .CompareURL}}{{else}}{{$more}}{{end}}{{end}}{{end}}`,
+	"tag_push": `{{escape .Author}} 推送了标签 {{link (escape .Ref) .URL}}`,
+	"issue":    `{{escape .Author}} {{tr .Action}}议题 {{link (escape .Title) .URL}}`,
+	"note": `{{escape .Author}} 发表了评论: {{escape .Note}}  {{escape .UpdatedAt}}
+{{link "查看详情" .URL}}`,
+	"merge_request": `{{escape .Author}} {{tr .Action}}合并请求 {{link (escape .Title) .URL}}
+{{code (escape .SourceBranch)}} → {{code (escape .TargetBranch)}}`,
+	"pipeline": `{{heading 3 (print (tr .RefType) " " (code (escape .Ref)) " 的流水线" (tr .Status))}}
+{{code "状态"}}: {{status .Status}} {{tr .Status}}
+{{code "开始时间"}}: {{escape .CreatedAt}}
+{{if .FinishedAt}}{{code "结束时间"}}: {{escape .FinishedAt}}
+{{end}}{{if gt .Duration 0}}{{code "耗时"}}: {{duration .Duration}}{{end}}`,
+	"build": `{{heading 3 (print (tr .RefType) " " (code (escape .Ref)) " 的任务 " (code (escape .Job)) " " (tr .Status))}}
+{{code "阶段"}}: {{escape .Stage}}
+{{if .FailureReason}}{{code "原因"}}: {{status .Status}} {{tr .FailureReason}}
+{{end}}{{if .Runner}}{{code "Runner"}}: {{escape .Runner}}
+{{end}}{{if gt .Duration 0}}{{code "耗时"}}: {{duration .Duration}}
+{{end}}{{link "查看任务" .URL}}`,
+	"deployment": `{{heading 3 (print (status .Status) " " (escape .Author) " " (tr (print "deploy_" .Status)) " " (code (escape .Ref)) " → " (code (escape .Environment)))}}
+{{range .Commits}}{{link (escape .Id) .Url}} {{escape (firstline .Message)}}
+{{end}}{{if .EnvironmentURL}}{{link "访问环境" .EnvironmentURL}} · {{end}}{{link "查看部署" .URL}}`,
+	"release": `{{heading 3 (print (tr .Action) "版本 " (link (escape .Title) .URL))}}
+{{code "标签"}}: {{escape .Ref}}
+{{if .Description}}{{escape (excerpt 500 .Description)}}
+{{end}}{{if .Assets}}{{code "附件"}}: {{range $i, $asset := .Assets}}{{if $i}} · {{end}}{{link (escape $asset.Name) $asset.URL}}{{end}}{{end}}`,
+}
+
+// localeTemplates the builtin templates of each locale
+var localeTemplates = map[string]*EventTemplate{
+	"en-US": localeTemplate("en-US", enTemplates),
+	"zh-CN": localeTemplate("zh-CN", zhTemplates),
+}
+
+func localeTemplate(locale string, kinds map[string]string) *EventTemplate {
+	t := mustEventTemplate(locale, kinds)
+	t.locale = locale
+	return t
+}
+
+func checkLocale(locale string) error {
+	if _, ok := localeTemplates[locale]; !ok && len(locale) > 0 {
+		return fmt.Errorf("unknown locale %q, must be en-US or zh-CN", locale)
+	}
+	return nil
+}
+
+func translate(locale, s string) string {
+	if word, ok := catalogs[locale][s]; ok {
+		return word
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummaryLocale(t *testing.T) {
+	event := sampleEvent("pipeline")
+	english := event.Summary()
+	if !strings.HasPrefix(english, "Pipeline ") {
+		t.Fatalf("summary %q, want the english summary", english)
+	}
+	wecom, _ := NewWeCom(&WeComConfig{Key: "key"})
+	target := Target{Name: "wecom", Notifier: wecom, Template: TemplateCard, Locale: "zh-CN", Renderer: defaultTemplate.withLocale("zh-CN")}
+	msg := target.messages(event, nil)[0]
+	if event.Locale != "" {
+		t.Errorf("locale %q set on the shared event", event.Locale)
+	}
+	if summary := msg.Event.Summary(); !strings.Contains(summary, "的流水线") {
+		t.Errorf("summary %q, want the chinese summary", summary)
+	}
+	card := buildWxCard(msg.Event)
+	if !strings.Contains(card.MainTitle.Title, "的流水线") || card.EmphasisContent.Desc != "状态" {
+		t.Errorf("card %q %q, want chinese labels", card.MainTitle.Title, card.EmphasisContent.Desc)
+	}
+	if card.JumpList[0].Title != "查看流水线" {
+		t.Errorf("action %q, want chinese", card.JumpList[0].Title)
+	}
+	header := buildFeishuCard(msg.Event, "").Header.Title.Content
+	if !strings.Contains(header, "的流水线") {
+		t.Errorf("feishu header %q, want the chinese summary", header)
+	}
+	for kind := range samplePayloads {
+		event := sampleEvent(kind)
+		event.Locale = "zh-CN"
+		if summary := event.Summary(); strings.Contains(summary, "%!") {
+			t.Errorf("%s: bad format %q", kind, summary)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type MatrixConfig struct {
+	Homeserver  string `json:"homeserver" yaml:"homeserver"`
+	AccessToken string `json:"access_token" yaml:"access_token"`
+	RoomID      string `json:"room_id" yaml:"room_id"`
+	MsgType     string `json:"msgtype" yaml:"msgtype"`
+}
+
+// Matrix posts m.room.message events through the client-server api
+type Matrix struct {
+	cfg    *MatrixConfig
+	client *http.Client
+}
+
+type matrixMsg struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+type matrixResp struct {
+	EventID      string `json:"event_id"`
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+func NewMatrix(cfg *MatrixConfig) (*Matrix, error) {
+	if len(cfg.Homeserver) == 0 {
+		return nil, fmt.Errorf("matrix.homeserver is empty")
+	}
+	if len(cfg.AccessToken) == 0 {
+		return nil, fmt.Errorf("matrix.access_token is empty")
+	}
+	if len(cfg.RoomID) == 0 {
+		return nil, fmt.Errorf("matrix.room_id is empty")
+	}
+	switch cfg.MsgType {
+	case "":
+		cfg.MsgType = "m.notice"
+	case "m.notice", "m.text":
+	default:
+		return nil, fmt.Errorf("matrix.msgtype must be m.notice or m.text")
+	}
+	cfg.Homeserver = strings.TrimRight(cfg.Homeserver, "/")
+	return &Matrix{cfg: cfg, client: NewClient()}, nil
+}
+
+func (m *Matrix) Markup() *Markup {
+	return HTMLMarkup
+}
+
+// Limit the event is limited to 64KB, the body is sent twice as body and formatted_body
+func (m *Matrix) Limit(msg *Message) int {
+	return 32 * 1024
+}
+
+// txnID is derived from the gitlab event uuid so a retried delivery is deduplicated by the homeserver
+func (m *Matrix) txnID(msg *Message, body []byte) string {
+	uuid := ""
+	if msg.Event != nil {
+		uuid = msg.Event.UUID
+	}
+	sum := sha256.Sum256([]byte(uuid + "\x00" + m.cfg.RoomID + "\x00" + string(body)))
+	return "gitlabot-" + hex.EncodeToString(sum[:16])
+}
+
+func (m *Matrix) Send(msg *Message) (*WxResp, error) {
+	body := &matrixMsg{MsgType: m.cfg.MsgType, Body: msg.Content}
+	if msg.Markdown {
+		body.Body = msg.Title
+		if msg.Event != nil {
+			body.Body = msg.render(PlainMarkup)
+		}
+		body.Format = "org.matrix.custom.html"
+		body.FormattedBody = strings.ReplaceAll(msg.Content, "\n", "<br>\n")
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	requestUrl := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.cfg.Homeserver, url.PathEscape(m.cfg.RoomID), m.txnID(msg, data))
+	req, err := http.NewRequest(http.MethodPut, requestUrl, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.cfg.AccessToken)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Request matrix homeserver err: %s", err)
+	}
+	defer resp.Body.Close()
+	matrixResp := &matrixResp{}
+	if err = json.NewDecoder(resp.Body).Decode(matrixResp); err != nil {
+		return nil, fmt.Errorf("Decode matrix response err: %s, status %d", err, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &RetryError{After: time.Duration(matrixResp.RetryAfterMs) * time.Millisecond, Msg: matrixResp.Error}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &WxResp{ErrCode: int64(resp.StatusCode), ErrMsg: matrixResp.ErrCode + ": " + matrixResp.Error}, nil
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: matrixResp.EventID}, nil
+}
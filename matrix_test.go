@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatrixSend(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method %s, want PUT", r.Method)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("authorization %q", auth)
+		}
+		paths = append(paths, r.URL.Path)
+		if len(paths) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errcode":"M_LIMIT_EXCEEDED","error":"Too many requests","retry_after_ms":1500}`))
+			return
+		}
+		w.Write([]byte(`{"event_id":"$event"}`))
+	}))
+	defer server.Close()
+	matrix, err := NewMatrix(&MatrixConfig{Homeserver: server.URL + "/", AccessToken: "token", RoomID: "!room:example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := Target{Name: "matrix", Notifier: matrix, Template: TemplateMarkdown, Renderer: defaultTemplate}
+	msg := target.messages(sampleEvent("push"), nil)[0]
+	_, err = matrix.Send(msg)
+	retry, ok := err.(*RetryError)
+	if !ok {
+		t.Fatalf("err %v, want a RetryError", err)
+	}
+	if retry.After != 1500*time.Millisecond {
+		t.Errorf("retry after %s, want 1.5s", retry.After)
+	}
+	resp, err := matrix.Send(msg)
+	if err != nil || resp.ErrCode != 0 || resp.ErrMsg != "$event" {
+		t.Fatalf("send: %v %v", resp, err)
+	}
+	prefix := "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/gitlabot-"
+	if !strings.HasPrefix(paths[0], prefix) {
+		t.Fatalf("path %q, want prefix %q", paths[0], prefix)
+	}
+	if paths[1] != paths[0] {
+		t.Errorf("txn id changed on retry: %q then %q", paths[0], paths[1])
+	}
+	other := sampleEvent("push")
+	other.UUID = "another-uuid"
+	if _, err = matrix.Send(target.messages(other, nil)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if paths[2] == paths[0] {
+		t.Errorf("txn id %q reused by another event", paths[2])
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// MattermostConfig an incoming webhook of mattermost or rocket.chat
+type MattermostConfig struct {
+	Webhook  string `json:"webhook" yaml:"webhook"`
+	Channel  string `json:"channel" yaml:"channel"`
+	Username string `json:"username" yaml:"username"`
+	IconURL  string `json:"icon_url" yaml:"icon_url"`
+}
+
+// Mattermost slack compatible incoming webhook of self-hosted mattermost and rocket.chat
+type Mattermost struct {
+	cfg        *MattermostConfig
+	rocketChat bool
+	client     *http.Client
+}
+
+type mattermostMsg struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	IconURL     string                 `json:"icon_url,omitempty"`
+	Alias       string                 `json:"alias,omitempty"`
+	Avatar      string                 `json:"avatar,omitempty"`
+	Text        string                 `json:"text,omitempty"`
+	Attachments []mattermostAttachment `json:"attachments,omitempty"`
+}
+
+type mattermostAttachment struct {
+	Fallback  string            `json:"fallback"`
+	Color     string            `json:"color"`
+	Title     string            `json:"title"`
+	TitleLink string            `json:"title_link,omitempty"`
+	Text      string            `json:"text"`
+	Fields    []mattermostField `json:"fields,omitempty"`
+}
+
+type mattermostField struct {
+	Short bool   `json:"short"`
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type rocketChatResp struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+func NewMattermost(cfg *MattermostConfig, rocketChat bool) (*Mattermost, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("webhook is empty")
+	}
+	return &Mattermost{cfg: cfg, rocketChat: rocketChat, client: NewClient()}, nil
+}
+
+func (m *Mattermost) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+// Limit the default max message length of the servers
+func (m *Mattermost) Limit(msg *Message) int {
+	if m.rocketChat {
+		return 5000
+	}
+	return 16383
+}
+
+func (m *Mattermost) buildMsg(msg *Message) *mattermostMsg {
+	body := &mattermostMsg{Channel: m.cfg.Channel}
+	// rocket.chat names the overrides alias and avatar
+	if m.rocketChat {
+		body.Alias, body.Avatar = m.cfg.Username, m.cfg.IconURL
+	} else {
+		body.Username, body.IconURL = m.cfg.Username, m.cfg.IconURL
+	}
+	if msg.Event == nil || !msg.Markdown {
+		body.Text = msg.Content
+		return body
+	}
+	e := msg.Event
+	attachment := mattermostAttachment{
+		Fallback:  e.Project + ": " + e.Summary(),
+		Color:     fmt.Sprintf("#%06x", eventColor(e)),
+		Title:     e.Project + " · " + e.Summary(),
+		TitleLink: e.URL,
+		Text:      msg.body(MarkdownMarkup),
+	}
+	addField := func(title, value string) {
+		if len(value) > 0 {
+			attachment.Fields = append(attachment.Fields, mattermostField{Short: true, Title: title, Value: value})
+		}
+	}
+	addField(e.tr("Author"), e.Author)
+	addField(e.tr("Status"), e.tr(e.Status))
+	addField(e.tr("Duration"), formatDuration(e.Duration))
+	body.Attachments = append(body.Attachments, attachment)
+	return body
+}
+
+func (m *Mattermost) Send(msg *Message) (*WxResp, error) {
+	data, err := json.Marshal(m.buildMsg(msg))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Post(m.cfg.Webhook, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request webhook err: %s", err)
+	}
+	defer resp.Body.Close()
+	text, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusResp(resp, text)
+	}
+	if m.rocketChat {
+		rocketChatResp := &rocketChatResp{}
+		if json.Unmarshal(text, rocketChatResp) == nil && !rocketChatResp.Success {
+			return &WxResp{ErrCode: int64(resp.StatusCode), ErrMsg: rocketChatResp.Error}, nil
+		}
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Metrics the counters exposed to prometheus
+type Metrics struct {
+	Webhooks  int64
+	DedupHits int64
+	Delivered int64
+	Failed    int64
+	Retried   int64
+}
+
+var metrics = &Metrics{}
+
+func (m *Metrics) inc(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// ServeMetrics writes the metrics in the prometheus text format
+func ServeMetrics(ctx *gin.Context) {
+	text := ""
+	counter := func(name, help string, value int64) {
+		text += fmt.Sprintf("# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("gitlabot_webhooks_total", "The gitlab webhooks received.", atomic.LoadInt64(&metrics.Webhooks))
+	counter("gitlabot_dedup_hits_total", "The redelivered webhooks skipped.", atomic.LoadInt64(&metrics.DedupHits))
+	counter("gitlabot_deliveries_total", "The jobs delivered.", atomic.LoadInt64(&metrics.Delivered))
+	counter("gitlabot_delivery_failures_total", "The jobs given up.", atomic.LoadInt64(&metrics.Failed))
+	counter("gitlabot_delivery_retries_total", "The delivery attempts retried.", atomic.LoadInt64(&metrics.Retried))
+	text += fmt.Sprintf("# HELP gitlabot_queue_length The jobs waiting in the queue.\n# TYPE gitlabot_queue_length gauge\ngitlabot_queue_length %d\n", queue.Len())
+	text += fmt.Sprintf("# HELP gitlabot_queue_pending The jobs not delivered or given up yet, including the ones waiting to be retried.\n# TYPE gitlabot_queue_pending gauge\ngitlabot_queue_pending %d\n", queue.Pending())
+	ctx.Render(200, render.Data{ContentType: "text/plain; version=0.0.4", Data: []byte(text)})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Notifier sends a rendered message to a chat backend, the message content is rendered with its Markup
+// and fits in the Limit bytes of the message, 0 for no limit
+type Notifier interface {
+	Markup() *Markup
+	Limit(msg *Message) int
+	Send(msg *Message) (*WxResp, error)
+}
+
+// Message a rendered gitlab event, Card asks for the native card of the backend when it has one, Mentions are the users to ping
+type Message struct {
+	Title      string
+	Content    string
+	URL        string
+	Markdown   bool
+	Card       bool
+	Event      *Event
+	Recipients []string
+	Mentions   []*UserConfig
+	Renderer   *EventTemplate `json:"-"`
+}
+
+// template the renderer of the message, the builtin templates when it has none
+func (msg *Message) template() *EventTemplate {
+	if msg.Renderer == nil {
+		return defaultTemplate
+	}
+	return msg.Renderer
+}
+
+// render renders the event again with another markup
+func (msg *Message) render(m *Markup) string {
+	return msg.template().Render(msg.Event, m)
+}
+
+// body renders the event without the project heading, for the backends showing the project on their own
+func (msg *Message) body(m *Markup) string {
+	return trans2Emoji(msg.template().Body(msg.Event, m))
+}
+
+// Retrier is implemented by the backends whose error codes are not http statuses, to tell which are worth retrying
+type Retrier interface {
+	Retryable(resp *WxResp) bool
+}
+
+// RateLimiter is implemented by the backends limiting the messages per key
+type RateLimiter interface {
+	RateLimit() (key string, perMinute int)
+}
+
+// Follower is implemented by the backends that cannot mention in every message,
+// FollowUp the message mentioning the users of msg, nil when msg mentions them itself
+type Follower interface {
+	FollowUp(msg *Message) *Message
+}
+
+// RetryError the backend is rate limited and asks to retry after After
+type RetryError struct {
+	After time.Duration
+	Msg   string
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Msg, e.After)
+}
+
+// Result the delivery result of one destination
+type Result struct {
+	Destination string `json:"destination"`
+	ErrCode     int64  `json:"errcode"`
+	ErrMsg      string `json:"errmsg"`
+}
+
+// TransmitResp the response to gitlab, ErrCode is the first failed result's
+type TransmitResp struct {
+	WxResp
+	Results []Result `json:"results"`
+}
+
+// notifier creates the backend of the destination
+func (d *DestinationConfig) notifier() (Notifier, error) {
+	switch {
+	case d.WeCom != nil:
+		return NewWeCom(d.WeCom)
+	case d.DingTalk != nil:
+		return NewDingTalk(d.DingTalk)
+	case d.Feishu != nil:
+		return NewFeishu(d.Feishu)
+	case d.Slack != nil:
+		return NewSlack(d.Slack)
+	case d.Teams != nil:
+		return NewTeams(d.Teams)
+	case d.Telegram != nil:
+		return NewTelegram(d.Telegram)
+	case d.Discord != nil:
+		return NewDiscord(d.Discord)
+	case d.Mattermost != nil:
+		return NewMattermost(d.Mattermost, false)
+	case d.RocketChat != nil:
+		return NewMattermost(d.RocketChat, true)
+	case d.Email != nil:
+		return NewEmail(d.Email)
+	case d.Webhook != nil:
+		return NewWebhook(d.Webhook)
+	case d.Matrix != nil:
+		return NewMatrix(d.Matrix)
+	}
+	return nil, fmt.Errorf("no backend configured")
+}
+
+// retryable network errors, rate limits and server errors are retried, wecom answers 45009 when rate limited
+func retryable(notifier Notifier, resp *WxResp, err error) bool {
+	if err != nil {
+		return true
+	}
+	if retrier, ok := notifier.(Retrier); ok {
+		return retrier.Retryable(resp)
+	}
+	return resp.ErrCode == 45009 || resp.ErrCode == http.StatusTooManyRequests || resp.ErrCode >= 500 && resp.ErrCode < 600
+}
+
+// statusResp the failure of a backend answering with http statuses, a 429 is retried after its Retry-After header
+func statusResp(resp *http.Response, text []byte) (*WxResp, error) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &RetryError{After: retryAfter(resp.Header), Msg: string(text)}
+	}
+	return &WxResp{ErrCode: int64(resp.StatusCode), ErrMsg: string(text)}, nil
+}
+
+// retryAfter the delay of the Retry-After header in seconds or as an http date, 0 without the header
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedBackendsRetry(t *testing.T) {
+	header := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(header) > 0 {
+			w.Header().Set("Retry-After", header)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("rate limited"))
+	}))
+	defer server.Close()
+	slack, _ := NewSlack(&SlackConfig{Webhook: server.URL})
+	teams, _ := NewTeams(&TeamsConfig{Webhook: server.URL})
+	mattermost, _ := NewMattermost(&MattermostConfig{Webhook: server.URL}, false)
+	rocketChat, _ := NewMattermost(&MattermostConfig{Webhook: server.URL}, true)
+	webhook, _ := NewWebhook(&WebhookConfig{URL: server.URL})
+	notifiers := map[string]Notifier{"slack": slack, "teams": teams, "mattermost": mattermost, "rocketchat": rocketChat, "webhook": webhook}
+	for _, c := range []struct {
+		header string
+		after  time.Duration
+	}{{"", 0}, {"7", 7 * time.Second}, {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute}} {
+		header = c.header
+		for name, notifier := range notifiers {
+			target := Target{Name: name, Notifier: notifier, Template: TemplateMarkdown, Renderer: defaultTemplate}
+			resp, err := notifier.Send(target.messages(sampleEvent("push"), nil)[0])
+			retry, ok := err.(*RetryError)
+			if !ok {
+				t.Errorf("%s: %v %v, want a RetryError", name, resp, err)
+				continue
+			}
+			if retry.After < c.after || retry.After > c.after+time.Minute {
+				t.Errorf("%s: Retry-After %q is %s, want %s", name, c.header, retry.After, c.after)
+			}
+			if !retryable(notifier, resp, err) {
+				t.Errorf("%s: rate limit not retried", name)
+			}
+		}
+	}
+	if !retryable(slack, &WxResp{ErrCode: http.StatusTooManyRequests}, nil) {
+		t.Error("429 not retried")
+	}
+}
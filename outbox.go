@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// compactEvery the count of delivered records after which the log is rewritten
+const compactEvery = 1000
+
+// Outbox persists the queued jobs to an append-only log, the jobs not delivered are replayed after a restart
+type Outbox struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	nextID int64
+	// pending the add records of the jobs not delivered yet
+	pending map[int64][]byte
+	done    int
+}
+
+type outboxRecord struct {
+	Op  string     `json:"op"`
+	ID  int64      `json:"id"`
+	Job *storedJob `json:"job,omitempty"`
+}
+
+// storedJob a job without its notifier and renderer, they are looked up in the config on replay
+type storedJob struct {
+	Destination string     `json:"destination"`
+	Template    string     `json:"template"`
+	Locale      string     `json:"locale"`
+	Messages    []*Message `json:"messages"`
+	// LegacyKey the wecom key of a legacy target, which is not in the config
+	LegacyKey string `json:"legacy_key,omitempty"`
+}
+
+// OpenOutbox loads the log of the dir, it returns the outbox and the jobs to replay
+func OpenOutbox(dir string) (*Outbox, map[int64]*storedJob, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	o := &Outbox{path: filepath.Join(dir, "outbox.log"), pending: map[int64][]byte{}}
+	jobs, err := o.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = o.compact(); err != nil {
+		return nil, nil, err
+	}
+	return o, jobs, nil
+}
+
+func (o *Outbox) load() (map[int64]*storedJob, error) {
+	jobs := map[int64]*storedJob{}
+	file, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := &outboxRecord{}
+		// the last line is torn when the process died while writing it
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			log.Printf("Skip broken outbox record: %s", err)
+			continue
+		}
+		if record.ID >= o.nextID {
+			o.nextID = record.ID + 1
+		}
+		switch record.Op {
+		case "add":
+			o.pending[record.ID] = append([]byte{}, scanner.Bytes()...)
+			jobs[record.ID] = record.Job
+		case "done":
+			delete(o.pending, record.ID)
+			delete(jobs, record.ID)
+		}
+	}
+	return jobs, scanner.Err()
+}
+
+// compact rewrites the log with the pending jobs only, the new log replaces the old one atomically
+func (o *Outbox) compact() error {
+	tmp := o.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	ids := []int64{}
+	for id := range o.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	writer := bufio.NewWriter(file)
+	for _, id := range ids {
+		writer.Write(o.pending[id])
+		writer.WriteByte('\n')
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	o.done = 0
+	return err
+}
+
+func (o *Outbox) append(record *outboxRecord, sync bool) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = o.file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	if sync {
+		err = o.file.Sync()
+	}
+	return line, err
+}
+
+// Add persists the job before it is queued and sets its ID
+func (o *Outbox) Add(job *Job) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := o.nextID
+	stored := &storedJob{Destination: job.Target.Name, Template: job.Target.Template, Locale: job.Target.Locale, Messages: job.Messages}
+	if wecom, ok := job.Target.Notifier.(*WeCom); ok && job.Target.Name == legacyDestination {
+		stored.LegacyKey = wecom.cfg.Key
+	}
+	// the id is not reused, a failed write may still have left the record
+	o.nextID++
+	line, err := o.append(&outboxRecord{Op: "add", ID: id, Job: stored}, true)
+	if err != nil {
+		return fmt.Errorf("write outbox err: %s", err)
+	}
+	job.ID = id
+	o.pending[id] = line
+	return nil
+}
+
+// Done marks the job delivered or given up, losing the record only means the job is sent again
+func (o *Outbox) Done(job *Job) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.pending[job.ID]; !ok {
+		return
+	}
+	delete(o.pending, job.ID)
+	if _, err := o.append(&outboxRecord{Op: "done", ID: job.ID}, false); err != nil {
+		log.Printf("Write outbox err: %s", err)
+	}
+	if o.done++; o.done >= compactEvery {
+		if err := o.compact(); err != nil {
+			log.Printf("Compact outbox err: %s", err)
+		}
+	}
+}
+
+// restoreJob rebuilds the stored job with the destination of the config, false when it is gone
+func (c *Config) restoreJob(id int64, stored *storedJob) (*Job, bool) {
+	// legacy targets are not in the config, their key is the token of the request
+	if len(stored.LegacyKey) > 0 {
+		job := &Job{ID: id, Target: legacyTarget(stored.LegacyKey), Messages: stored.Messages}
+		for _, msg := range job.Messages {
+			msg.Renderer = job.Target.Renderer
+		}
+		return job, true
+	}
+	notifier, ok := c.notifiers[stored.Destination]
+	if !ok {
+		return nil, false
+	}
+	renderer, ok := c.templates[stored.Template]
+	if !ok {
+		renderer = defaultTemplate
+	}
+	renderer = renderer.withLocale(stored.Locale)
+	for _, msg := range stored.Messages {
+		msg.Renderer = renderer
+	}
+	target := Target{Name: stored.Destination, Notifier: notifier, Template: stored.Template, Locale: stored.Locale, Renderer: renderer}
+	return &Job{ID: id, Target: target, Messages: stored.Messages}, true
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxLegacyJob(t *testing.T) {
+	dir := t.TempDir()
+	outbox, _, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := legacyTarget("legacy-key")
+	job := &Job{Target: target, Messages: target.messages(sampleEvent("push"), nil)}
+	if err = outbox.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	_, stored, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("stored %d jobs, want 1", len(stored))
+	}
+	restored, ok := (&Config{}).restoreJob(job.ID, stored[job.ID])
+	if !ok {
+		t.Fatal("legacy job is not restored")
+	}
+	wecom, ok := restored.Target.Notifier.(*WeCom)
+	if !ok || wecom.cfg.Key != "legacy-key" {
+		t.Fatalf("restored notifier %#v, want the wecom of legacy-key", restored.Target.Notifier)
+	}
+	if restored.Messages[0].Content != job.Messages[0].Content {
+		t.Errorf("restored content %q, want %q", restored.Messages[0].Content, job.Messages[0].Content)
+	}
+}
+
+func TestQueueJobNotPersisted(t *testing.T) {
+	outbox, _, err := OpenOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueue(10, 0, 0, outbox)
+	target := legacyTarget("key")
+	persisted := &Job{Target: target, Messages: target.messages(sampleEvent("push"), nil)}
+	if !q.Push(persisted) {
+		t.Fatal("push failed")
+	}
+	// the writes fail from now on
+	outbox.file.Close()
+	failed := &Job{Target: target, Messages: target.messages(sampleEvent("push"), nil)}
+	if !q.Push(failed) {
+		t.Fatal("push failed")
+	}
+	if failed.ID != notPersisted {
+		t.Fatalf("ID of the job not persisted %d, want %d", failed.ID, notPersisted)
+	}
+	q.finish(failed)
+	if _, ok := outbox.pending[persisted.ID]; !ok {
+		t.Fatalf("job %d is marked done by the job not persisted", persisted.ID)
+	}
+}
+
+// stubNotifier records the content of the messages it is sent
+type stubNotifier struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *stubNotifier) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+func (s *stubNotifier) Limit(msg *Message) int {
+	return 0
+}
+
+func (s *stubNotifier) Send(msg *Message) (*WxResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg.Content)
+	return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+}
+
+func (s *stubNotifier) Sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.sent...)
+}
+
+func stubJob(notifier Notifier, i int) *Job {
+	return &Job{Target: Target{Name: "stub", Notifier: notifier, Template: TemplateMarkdown}, Messages: []*Message{{Content: fmt.Sprintf("job %d", i), Markdown: true}}}
+}
+
+// TestOutboxCrashHelper is run by TestOutboxCrash in a child process that is killed while jobs are pending
+func TestOutboxCrashHelper(t *testing.T) {
+	dir := os.Getenv("GITLABOT_CRASH_DIR")
+	if len(dir) == 0 {
+		t.Skip("run by TestOutboxCrash")
+	}
+	outbox, _, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []*Job{}
+	for i := 0; i < 5; i++ {
+		job := stubJob(&stubNotifier{}, i)
+		if err = outbox.Add(job); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	outbox.Done(jobs[0])
+	outbox.Done(jobs[1])
+	// the process dies in the middle of the next record
+	outbox.file.Write([]byte(`{"op":"add","id":5,"job":{"destination":"st`))
+	fmt.Println("ready")
+	select {}
+}
+
+func TestOutboxCrash(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOutboxCrashHelper$")
+	cmd.Env = append(os.Environ(), "GITLABOT_CRASH_DIR="+dir)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan bool)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if scanner.Text() == "ready" {
+				ready <- true
+				return
+			}
+		}
+		close(ready)
+	}()
+	select {
+	case ok := <-ready:
+		if !ok {
+			t.Fatal("helper exited before it was ready")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("helper is not ready")
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	outbox, stored, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Fatalf("stored %d jobs, want the 3 pending ones", len(stored))
+	}
+	notifier := &stubNotifier{}
+	cfg := &Config{notifiers: map[string]Notifier{"stub": notifier}}
+	q := NewQueue(10, 1, 0, outbox)
+	q.Replay(cfg, stored)
+	want := []string{"job 2", "job 3", "job 4"}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(notifier.Sent()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// a duplicate would show up shortly after
+	time.Sleep(50 * time.Millisecond)
+	if sent := notifier.Sent(); fmt.Sprint(sent) != fmt.Sprint(want) {
+		t.Fatalf("replayed %q, want %q", sent, want)
+	}
+	for time.Now().Before(deadline) {
+		outbox.mu.Lock()
+		pending := len(outbox.pending)
+		outbox.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the replayed jobs are done, nothing is left for the next start
+	if _, stored, err = OpenOutbox(dir); err != nil || len(stored) != 0 {
+		t.Fatalf("left %d jobs after the replay, err %v", len(stored), err)
+	}
+}
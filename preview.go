@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewResp the rendered content of the preview
+type PreviewResp struct {
+	WxResp
+	Content string `json:"content"`
+}
+
+// PreviewTemplate renders a template against the posted payload, or the sample of the event when the body is empty.
+// The template and the markup are given by the query, the event by X-Gitlab-Event or the query
+func PreviewTemplate(ctx *gin.Context) {
+	cfg := configStore.Get()
+	if _, ok := cfg.lookupSecret(ctx.GetHeader("X-Gitlab-Token")); !ok {
+		ctx.JSON(403, WxResp{ErrCode: 403, ErrMsg: "X-Gitlab-Token is invalid"})
+		return
+	}
+	kind := ctx.DefaultQuery("event", ctx.GetHeader("X-Gitlab-Event"))
+	renderer := defaultTemplate
+	if name := ctx.DefaultQuery("template", TemplateMarkdown); name != TemplateMarkdown && name != TemplateText && name != TemplateCard {
+		var ok bool
+		if renderer, ok = cfg.templates[name]; !ok {
+			ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("unknown template %q", name)})
+			return
+		}
+	}
+	locale := ctx.DefaultQuery("locale", cfg.Locale)
+	if err := checkLocale(locale); err != nil {
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: err.Error()})
+		return
+	}
+	renderer = renderer.withLocale(locale)
+	m, ok := markups[ctx.DefaultQuery("markup", "markdown")]
+	if !ok {
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: "markup must be markdown, slack, simple, html or plain"})
+		return
+	}
+	data, err := ctx.GetRawData()
+	if err != nil {
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("Read preview requset body error: %s", err)})
+		return
+	}
+	var event *Event
+	if len(data) == 0 {
+		event = sampleEvent(kind)
+	} else {
+		event, err = parseEvent(kind, data)
+	}
+	if err != nil {
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("Parse preview requset body error: %s", err)})
+		return
+	}
+	if event == nil {
+		ctx.JSON(400, WxResp{ErrCode: 400, ErrMsg: fmt.Sprintf("unsupported event %q", kind)})
+		return
+	}
+	ctx.JSON(200, PreviewResp{WxResp: WxResp{ErrCode: 0, ErrMsg: "ok"}, Content: renderer.Render(event, m)})
+}
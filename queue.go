@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	retryBase = time.Second
+	retryMax  = 5 * time.Minute
+	// notPersisted the ID of the jobs the outbox failed to write, they have no record to mark done
+	notPersisted = -1
+)
+
+// pushTimeout how long a request waits for room in a full queue
+var pushTimeout = 5 * time.Second
+
+// Job the messages of an event for one destination, they are delivered in order
+type Job struct {
+	// ID the id in the outbox
+	ID       int64
+	Target   Target
+	Messages []*Message
+	Attempts int
+	// next the first message not delivered yet
+	next int
+	// merged the rate limited jobs coalesced into this one
+	merged []*Job
+}
+
+// Queue delivers the jobs from a pool of workers, failed jobs are retried with exponential backoff
+// and persisted to the outbox when there is one
+type Queue struct {
+	jobs chan *Job
+	// slots one per job until it is finished, queued, sent, waiting to be retried or parked,
+	// so the retried and flushed jobs always find room in jobs
+	slots      chan struct{}
+	maxRetries int
+	outbox     *Outbox
+	mu         sync.Mutex
+	windows    map[string]*Window
+	// parked the jobs waiting for the budget of their rate limit key, flushed the job queued for them
+	parked    map[string][]*Job
+	flushed   map[string]*Job
+	scheduled map[string]bool
+}
+
+func NewQueue(size, workers, maxRetries int, outbox *Outbox) *Queue {
+	rand.Seed(time.Now().UnixNano())
+	q := &Queue{jobs: make(chan *Job, size), slots: make(chan struct{}, size), maxRetries: maxRetries, outbox: outbox, windows: map[string]*Window{}, parked: map[string][]*Job{}, flushed: map[string]*Job{}, scheduled: map[string]bool{}}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Push queues the jobs of an event, all of them or, when the queue stays full for pushTimeout, none,
+// so an event gitlab sends again is not delivered twice to the destinations queued the first time
+func (q *Queue) Push(jobs ...*Job) bool {
+	if !q.reserve(len(jobs)) {
+		return false
+	}
+	for _, job := range jobs {
+		if q.outbox != nil {
+			if err := q.outbox.Add(job); err != nil {
+				log.Printf("Persist job of %s err: %s", job.Target.Name, err)
+				job.ID = notPersisted
+			}
+		}
+		q.jobs <- job
+	}
+	return true
+}
+
+// reserve takes n slots, it gives back the ones taken when the queue stays full for pushTimeout
+func (q *Queue) reserve(n int) bool {
+	if n > cap(q.slots) {
+		return false
+	}
+	timer := time.NewTimer(pushTimeout)
+	defer timer.Stop()
+	for i := 0; i < n; i++ {
+		select {
+		case q.slots <- struct{}{}:
+		case <-timer.C:
+			for ; i > 0; i-- {
+				<-q.slots
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// Len the jobs waiting for a worker
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Pending the jobs not finished yet, including the ones waiting to be retried
+func (q *Queue) Pending() int {
+	return len(q.slots)
+}
+
+// Replay queues the jobs left in the outbox by the last run
+func (q *Queue) Replay(cfg *Config, stored map[int64]*storedJob) {
+	ids := []int64{}
+	for id := range stored {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	jobs := []*Job{}
+	for _, id := range ids {
+		job, ok := cfg.restoreJob(id, stored[id])
+		if !ok {
+			log.Printf("Drop stored job %d, destination %s is gone", id, stored[id].Destination)
+			q.forget(&Job{ID: id})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) > 0 {
+		log.Printf("Replay %d jobs from the outbox", len(jobs))
+	}
+	go func() {
+		for _, job := range jobs {
+			q.slots <- struct{}{}
+			q.jobs <- job
+		}
+	}()
+}
+
+// finish the job is delivered or given up, the merged job holds no slot, the jobs merged into it do
+func (q *Queue) finish(job *Job) {
+	for _, merged := range job.merged {
+		q.finish(merged)
+	}
+	if job.merged == nil {
+		q.forget(job)
+		<-q.slots
+	}
+}
+
+// forget removes the job from the outbox
+func (q *Queue) forget(job *Job) {
+	if q.outbox != nil && job.ID != notPersisted {
+		q.outbox.Done(job)
+	}
+}
+
+func (q *Queue) work() {
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+func (q *Queue) deliver(job *Job) {
+	for job.next < len(job.Messages) {
+		if !q.admit(job, job.Messages[job.next]) {
+			return
+		}
+		resp, err := job.Target.Notifier.Send(job.Messages[job.next])
+		if err == nil && resp.ErrCode == 0 {
+			job.next++
+			continue
+		}
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.ErrMsg
+		}
+		if !retryable(job.Target.Notifier, resp, err) || job.Attempts >= q.maxRetries {
+			log.Printf("Deliver to %s failed after %d attempts: %s", job.Target.Name, job.Attempts+1, reason)
+			metrics.inc(&metrics.Failed)
+			q.settle(job)
+			q.finish(job)
+			return
+		}
+		job.Attempts++
+		metrics.inc(&metrics.Retried)
+		delay := backoff(job.Attempts)
+		if retry, ok := err.(*RetryError); ok && retry.After > delay {
+			delay = retry.After
+		}
+		log.Printf("Deliver to %s failed: %s, retry in %s", job.Target.Name, reason, delay)
+		q.settle(job)
+		// the worker is freed while waiting, the job keeps its slot so there is room when it is queued again
+		time.AfterFunc(delay, func() { q.jobs <- job })
+		return
+	}
+	metrics.inc(&metrics.Delivered)
+	q.settle(job)
+	q.finish(job)
+}
+
+// backoff the delay before the attempt, doubled every attempt up to retryMax with a random jitter of half of it
+func backoff(attempt int) time.Duration {
+	delay := retryMax
+	if attempt < 20 {
+		if d := retryBase << uint(attempt-1); d < retryMax {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyNotifier fails with a network error until it is healed
+type flakyNotifier struct {
+	stubNotifier
+	healed int32
+}
+
+func (n *flakyNotifier) Send(msg *Message) (*WxResp, error) {
+	if atomic.LoadInt32(&n.healed) == 0 {
+		return nil, &RetryError{Msg: "down"}
+	}
+	return n.stubNotifier.Send(msg)
+}
+
+func TestRetriesCountAgainstQueueSize(t *testing.T) {
+	defer func(timeout time.Duration) { pushTimeout = timeout }(pushTimeout)
+	pushTimeout = 50 * time.Millisecond
+	q := NewQueue(2, 1, 100, nil)
+	notifier := &flakyNotifier{}
+	for i := 0; i < 2; i++ {
+		if !q.Push(stubJob(notifier, i)) {
+			t.Fatalf("push %d failed", i)
+		}
+	}
+	// the jobs wait to be retried, they are out of the channel but still hold the queue
+	deadline := time.Now().Add(time.Second)
+	for q.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if q.Push(stubJob(notifier, 2)) {
+		t.Fatal("push accepted over the queue size while jobs wait to be retried")
+	}
+	if pending := q.Pending(); pending != 2 {
+		t.Fatalf("pending %d, want 2", pending)
+	}
+	atomic.StoreInt32(&notifier.healed, 1)
+	deadline = time.Now().Add(5 * time.Second)
+	for q.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := notifier.Sent(); len(sent) != 2 {
+		t.Fatalf("sent %q, want the 2 retried jobs", sent)
+	}
+	if !q.Push(stubJob(notifier, 3)) {
+		t.Fatal("push failed once the retried jobs are delivered")
+	}
+}
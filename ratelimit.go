@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// coalesceSeparator joins the messages coalesced into one
+const coalesceSeparator = "\n\n"
+
+// rateInterval the interval the rate limits are counted in
+var rateInterval = time.Minute
+
+// Window a sliding window of the send times, no interval holds more than size sends
+type Window struct {
+	size     int
+	interval time.Duration
+	// sent the send times within the last interval, oldest first
+	sent []time.Time
+}
+
+func NewWindow(size int, interval time.Duration) *Window {
+	return &Window{size: size, interval: interval}
+}
+
+// Wait how long until n more sends fit in the window
+func (w *Window) Wait(n int) time.Duration {
+	now := time.Now()
+	expired := 0
+	for expired < len(w.sent) && now.Sub(w.sent[expired]) >= w.interval {
+		expired++
+	}
+	w.sent = w.sent[expired:]
+	if n > w.size {
+		n = w.size
+	}
+	over := len(w.sent) + n - w.size
+	if over <= 0 {
+		return 0
+	}
+	// the sends leaving the window make room for n
+	return w.sent[over-1].Add(w.interval).Sub(now)
+}
+
+// Take records n sends, when they do not fit it records none and returns how long until they do
+func (w *Window) Take(n int) time.Duration {
+	if wait := w.Wait(n); wait > 0 {
+		return wait
+	}
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		w.sent = append(w.sent, now)
+	}
+	return 0
+}
+
+// admit takes the cost of the message from the budget of its key, when the budget is exhausted
+// the job is parked and coalesced with the others parked for the key once there is budget again
+func (q *Queue) admit(job *Job, msg *Message) bool {
+	limiter, ok := job.Target.Notifier.(RateLimiter)
+	if !ok {
+		return true
+	}
+	key, perMinute := limiter.RateLimit()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	window, ok := q.windows[key]
+	if !ok {
+		window = NewWindow(perMinute, rateInterval)
+		q.windows[key] = window
+	}
+	flushed := q.flushed[key]
+	// the jobs parked first are sent first, the newer ones wait behind them until the job flushed for them is sent
+	if flushed != job && (flushed != nil || len(q.parked[key]) > 0) {
+		q.parked[key] = append(q.parked[key], job)
+		return false
+	}
+	wait := window.Take(1)
+	if wait == 0 {
+		return true
+	}
+	if flushed == job {
+		delete(q.flushed, key)
+		q.parked[key] = append([]*Job{job}, q.parked[key]...)
+	} else {
+		q.parked[key] = append(q.parked[key], job)
+	}
+	q.schedule(key, wait)
+	return false
+}
+
+// settle the job is done with its key, delivered, given up or waiting to be retried, the jobs parked behind it follow
+func (q *Queue) settle(job *Job) {
+	limiter, ok := job.Target.Notifier.(RateLimiter)
+	if !ok {
+		return
+	}
+	key, _ := limiter.RateLimit()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.flushed[key] == job {
+		delete(q.flushed, key)
+	}
+	if len(q.parked[key]) > 0 {
+		q.schedule(key, q.windows[key].Wait(1))
+	}
+}
+
+// schedule flushes the key after wait unless it is scheduled already, the caller holds mu
+func (q *Queue) schedule(key string, wait time.Duration) {
+	if q.scheduled[key] {
+		return
+	}
+	q.scheduled[key] = true
+	time.AfterFunc(wait, func() { q.flush(key) })
+}
+
+// flush queues the jobs parked for the key again as one job, the key stays parked until the job is sent
+func (q *Queue) flush(key string) {
+	q.mu.Lock()
+	delete(q.scheduled, key)
+	jobs := q.parked[key]
+	// the job flushed before is still being sent, it flushes the key again when it is done
+	if len(jobs) == 0 || q.flushed[key] != nil {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.parked, key)
+	job := jobs[0]
+	if len(jobs) > 1 {
+		job = coalesce(jobs)
+		log.Printf("Rate limited, coalesce %d jobs of %s into %d messages", len(jobs), job.Target.Name, len(job.Messages))
+	}
+	q.flushed[key] = job
+	q.mu.Unlock()
+	q.jobs <- job
+}
+
+// coalesce merges the messages left in the jobs into as few messages as the limit of the backend allows,
+// the jobs are finished with the merged one
+func coalesce(jobs []*Job) *Job {
+	notifier := jobs[0].Target.Notifier
+	merged := &Job{Target: jobs[0].Target, merged: jobs}
+	// the markdown and the text messages, such as the mentions following the markdown, are merged apart
+	lasts := map[bool]*Message{}
+	for _, job := range jobs {
+		for _, msg := range job.Messages[job.next:] {
+			if last := lasts[msg.Markdown]; last != nil && fits(notifier, last, len(last.Content)+len(coalesceSeparator)+len(msg.Content)) {
+				last.Content = strings.TrimRight(last.Content, "\n") + coalesceSeparator + msg.Content
+				last.Mentions = mergeMentions(last.Mentions, msg.Mentions)
+				continue
+			}
+			// the merged content is sent as is, the backends would render the event again
+			copied := *msg
+			copied.Event, copied.Card = nil, false
+			lasts[msg.Markdown] = &copied
+			merged.Messages = append(merged.Messages, &copied)
+		}
+	}
+	return merged
+}
+
+// fits the content of size bytes fits in the limit of the message
+func fits(notifier Notifier, msg *Message, size int) bool {
+	limit := notifier.Limit(msg)
+	return limit <= 0 || size <= limit
+}
+
+func mergeMentions(users, more []*UserConfig) []*UserConfig {
+	result := append([]*UserConfig{}, users...)
+	for _, user := range more {
+		seen := false
+		for _, u := range result {
+			seen = seen || u == user
+		}
+		if !seen {
+			result = append(result, user)
+		}
+	}
+	return result
+}
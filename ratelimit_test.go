@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowNeverExceedsSize(t *testing.T) {
+	const size, interval = 5, 100 * time.Millisecond
+	w := NewWindow(size, interval)
+	sent := []time.Time{}
+	for end := time.Now().Add(3 * interval); time.Now().Before(end); {
+		if wait := w.Take(1); wait > 0 {
+			if wait > interval {
+				t.Fatalf("wait %s is longer than the interval", wait)
+			}
+			time.Sleep(wait)
+			continue
+		}
+		sent = append(sent, time.Now())
+	}
+	if len(sent) < 2*size {
+		t.Fatalf("sent %d in 3 intervals, want at least %d", len(sent), 2*size)
+	}
+	for i := range sent {
+		n := 0
+		for _, at := range sent[i:] {
+			if at.Sub(sent[i]) < interval {
+				n++
+			}
+		}
+		if n > size {
+			t.Fatalf("%d sends within %s from %d, want at most %d", n, interval, i, size)
+		}
+	}
+}
+
+func TestWindowCost(t *testing.T) {
+	w := NewWindow(3, time.Minute)
+	if wait := w.Take(2); wait != 0 {
+		t.Fatalf("first take waits %s", wait)
+	}
+	if wait := w.Take(2); wait <= 0 {
+		t.Fatal("take over the size does not wait")
+	}
+	if wait := w.Take(1); wait != 0 {
+		t.Fatalf("take within the size waits %s", wait)
+	}
+}
+
+// limitedNotifier a stub sending one message per rateInterval
+type limitedNotifier struct {
+	stubNotifier
+}
+
+func (n *limitedNotifier) RateLimit() (string, int) {
+	return "limited", 1
+}
+
+func TestFlushedJobGoesFirst(t *testing.T) {
+	defer func(interval time.Duration) { rateInterval = interval }(rateInterval)
+	rateInterval = 50 * time.Millisecond
+	q := NewQueue(10, 0, 0, nil)
+	notifier := &limitedNotifier{}
+	first, second, third := stubJob(notifier, 1), stubJob(notifier, 2), stubJob(notifier, 3)
+	if !q.admit(first, first.Messages[0]) {
+		t.Fatal("the first job is not admitted")
+	}
+	q.settle(first)
+	if q.admit(second, second.Messages[0]) {
+		t.Fatal("the second job is admitted over the budget")
+	}
+	flushed := <-q.jobs
+	if flushed != second {
+		t.Fatalf("flushed %v, want the second job", flushed)
+	}
+	// the budget is back before the flushed job is picked up, the newer job still waits behind it
+	time.Sleep(rateInterval)
+	if q.admit(third, third.Messages[0]) {
+		t.Fatal("the third job is admitted before the flushed one")
+	}
+	if !q.admit(flushed, flushed.Messages[0]) {
+		t.Fatal("the flushed job is not admitted")
+	}
+	q.settle(flushed)
+	select {
+	case job := <-q.jobs:
+		if job != third {
+			t.Fatalf("flushed %v, want the third job", job)
+		}
+	case <-time.After(5 * rateInterval):
+		t.Fatal("the third job is not flushed")
+	}
+}
+
+func TestCoalesceParkedJobs(t *testing.T) {
+	notifier := &stubNotifier{}
+	merged := coalesce([]*Job{stubJob(notifier, 1), stubJob(notifier, 2), stubJob(notifier, 3)})
+	if len(merged.Messages) != 1 || merged.Messages[0].Content != "job 1\n\njob 2\n\njob 3" {
+		t.Fatalf("coalesced %q", merged.Messages[0].Content)
+	}
+}
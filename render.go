@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var pipelineStatusEmoji = map[string]string{
+	"failed":  "🐛",
+	"running": "🚀",
+	"success": "✅",
+	"pending": "🔒",
+}
+
+// Markup the rich text syntax of a backend, Escape is applied to every value taken from the event
+type Markup struct {
+	Heading func(level int, s string) string
+	Link    func(text, url string) string
+	Bold    func(s string) string
+	Code    func(s string) string
+	Escape  func(s string) string
+}
+
+// MarkdownMarkup wexin and dingtalk markdown
+var MarkdownMarkup = &Markup{
+	Heading: func(level int, s string) string { return strings.Repeat("#", level) + " " + s },
+	Link:    func(text, url string) string { return fmt.Sprintf("[%s](%s)", text, url) },
+	Bold:    func(s string) string { return "**" + s + "**" },
+	Code:    func(s string) string { return "`" + s + "`" },
+	Escape:  func(s string) string { return s },
+}
+
+// SlackMarkup slack mrkdwn
+var SlackMarkup = &Markup{
+	Heading: func(level int, s string) string { return "*" + s + "*" },
+	Link:    func(text, url string) string { return fmt.Sprintf("<%s|%s>", url, text) },
+	Bold:    func(s string) string { return "*" + s + "*" },
+	Code:    func(s string) string { return "`" + s + "`" },
+	Escape:  escapeEntities,
+}
+
+// SimpleMarkup markdown without heading and inline code, feishu lark_md and teams adaptive cards
+var SimpleMarkup = &Markup{
+	Heading: func(level int, s string) string { return "**" + s + "**" },
+	Link:    MarkdownMarkup.Link,
+	Bold:    MarkdownMarkup.Bold,
+	Code:    func(s string) string { return s },
+	Escape:  MarkdownMarkup.Escape,
+}
+
+// HTMLMarkup the html subset of telegram, newlines are kept as is
+var HTMLMarkup = &Markup{
+	Heading: func(level int, s string) string { return "<b>" + s + "</b>" },
+	Link: func(text, url string) string {
+		return fmt.Sprintf(`<a href="%s">%s</a>`, strings.ReplaceAll(escapeEntities(url), `"`, "&quot;"), text)
+	},
+	Bold:   func(s string) string { return "<b>" + s + "</b>" },
+	Code:   func(s string) string { return "<code>" + s + "</code>" },
+	Escape: escapeEntities,
+}
+
+// PlainMarkup plain text, links are written as text (url)
+var PlainMarkup = &Markup{
+	Heading: func(level int, s string) string { return s },
+	Link: func(text, url string) string {
+		if len(url) == 0 {
+			return text
+		}
+		return fmt.Sprintf("%s (%s)", text, url)
+	},
+	Bold:   func(s string) string { return s },
+	Code:   func(s string) string { return s },
+	Escape: func(s string) string { return s },
+}
+
+// markups the markups by name, for the template preview
+var markups = map[string]*Markup{
+	"markdown": MarkdownMarkup,
+	"slack":    SlackMarkup,
+	"simple":   SimpleMarkup,
+	"html":     HTMLMarkup,
+	"plain":    PlainMarkup,
+}
+
+// escapeEntities escapes &, < and > as both slack and html require
+func escapeEntities(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// renderEvent renders the event with a project heading using the builtin templates
+func renderEvent(e *Event, m *Markup) string {
+	return defaultTemplate.Render(e, m)
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(strings.TrimSpace(s), "\n", 2)[0]
+}
+
+// Summary a one line plain text description of the event, in the Locale of the event
+func (e *Event) Summary() string {
+	switch e.ObjectKind {
+	case "push":
+		if e.Removed {
+			return e.sprintf("%s removed branch %s", e.Author, e.Ref)
+		}
+		return e.sprintf("%s pushed %d commits to %s", e.Author, len(e.Commits)+e.MoreCommits, e.Ref)
+	case "tag_push":
+		return e.sprintf("%s pushed tag %s", e.Author, e.Ref)
+	case "issue":
+		return e.sprintf("%s %s issue %s", e.Author, e.tr(e.Action), e.Title)
+	case "note":
+		return e.sprintf("%s left a comment", e.Author)
+	case "merge_request":
+		return e.sprintf("%s %s merge request %s", e.Author, e.tr(e.Action), e.Title)
+	case "pipeline":
+		return e.sprintf("Pipeline %s on %s %s", e.tr(e.Status), e.tr(e.RefType()), e.Ref)
+	case "build":
+		return e.sprintf("Job %s %s in stage %s on %s %s", e.Job, e.tr(e.Status), e.Stage, e.tr(e.RefType()), e.Ref)
+	case "deployment":
+		return e.sprintf("%s %s %s by %s", e.Ref, e.deployed(), e.Environment, e.Author)
+	case "release":
+		action := translate("en-US", e.Action)
+		if e.Locale != "" {
+			action = e.tr(e.Action)
+		}
+		return e.sprintf("Release %s %s", e.Title, action)
+	}
+	return e.Kind
+}
+
+// tr translates s into the Locale of the event
+func (e *Event) tr(s string) string {
+	return translate(e.Locale, s)
+}
+
+// sprintf formats with the translation of format, the translations reorder the args with %[n]s
+func (e *Event) sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(e.tr(format), args...)
+}
+
+// deployed the deploy_ phrase of the Locale, or Deployed
+func (e *Event) deployed() string {
+	key := "deploy_" + e.Status
+	if phrase := e.tr(key); phrase != key {
+		return phrase
+	}
+	return e.Deployed()
+}
+
+// eventColor the color of the pipeline status, or of the event kind
+func eventColor(e *Event) int {
+	switch e.Status {
+	case "success":
+		return 0x2ecc71
+	case "failed":
+		return 0xe74c3c
+	case "running":
+		return 0x3498db
+	case "pending":
+		return 0xf1c40f
+	}
+	switch e.ObjectKind {
+	case "tag_push", "release":
+		return 0x9b59b6
+	case "merge_request":
+		return 0x1abc9c
+	case "issue":
+		return 0xe67e22
+	case "note":
+		return 0x95a5a6
+	}
+	return 0x7289da
+}
+
+// actionText the text of the button linking to the event
+func actionText(e *Event) string {
+	switch e.ObjectKind {
+	case "merge_request":
+		return e.tr("View MR")
+	case "pipeline":
+		return e.tr("View pipeline")
+	case "build":
+		return e.tr("View job")
+	case "deployment":
+		return e.tr("View deployment")
+	case "release":
+		return e.tr("View release")
+	}
+	return e.tr("Detail")
+}
+
+// formatDuration formats seconds as 1h2m3s
+func formatDuration(seconds int64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	s := ""
+	if h := seconds / 3600; h > 0 {
+		s += fmt.Sprintf("%dh", h)
+	}
+	if m := seconds % 3600 / 60; m > 0 {
+		s += fmt.Sprintf("%dm", m)
+	}
+	if sec := seconds % 60; sec > 0 {
+		s += fmt.Sprintf("%ds", sec)
+	}
+	return s
+}
+
+// gitlab uses both formats depending on the hook
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Time the latest time the event carries
+func (e *Event) Time() string {
+	for _, t := range []string{e.FinishedAt, e.UpdatedAt, e.CreatedAt} {
+		if len(t) > 0 {
+			return t
+		}
+	}
+	if len(e.Commits) > 0 {
+		return e.Commits[len(e.Commits)-1].TimeStamp
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Route sends the events matching Match to Destinations, an empty matcher matches everything
+type Route struct {
+	Name         string     `json:"name" yaml:"name"`
+	Secrets      []string   `json:"secrets" yaml:"secrets"`
+	Match        RouteMatch `json:"match" yaml:"match"`
+	Destinations []string   `json:"destinations" yaml:"destinations"`
+	Template     string     `json:"template" yaml:"template"`
+	Recipients   []string   `json:"recipients" yaml:"recipients"`
+	// Split sends a message over the limit of the backend as ordered parts instead of truncating it
+	Split bool `json:"split" yaml:"split"`
+	// Locale overrides the locale of the config
+	Locale string `json:"locale" yaml:"locale"`
+}
+
+// RouteMatch every non-empty field must match, values inside a field are alternatives
+type RouteMatch struct {
+	Projects []string `json:"projects" yaml:"projects"`
+	Events   []string `json:"events" yaml:"events"`
+	Refs     []string `json:"refs" yaml:"refs"`
+	Authors  []string `json:"authors" yaml:"authors"`
+	Labels   []string `json:"labels" yaml:"labels"`
+	// Environments and Tiers the environment name and tier of a deployment
+	Environments []string `json:"environments" yaml:"environments"`
+	Tiers        []string `json:"tiers" yaml:"tiers"`
+}
+
+// Builtin templates
+const (
+	TemplateMarkdown = "markdown"
+	TemplateText     = "text"
+	// TemplateCard markdown, wecom sends pipelines and merge requests as template cards
+	TemplateCard = "card"
+)
+
+// Target a destination an event is sent to with the template to render it, Recipients are for email
+type Target struct {
+	Name       string
+	Notifier   Notifier
+	Template   string
+	Recipients []string
+	Split      bool
+	Locale     string
+	Renderer   *EventTemplate
+}
+
+func (r *Route) validate(c *Config) error {
+	if len(r.Destinations) == 0 {
+		return fmt.Errorf("no destinations")
+	}
+	if err := c.checkDestinations(r.Destinations); err != nil {
+		return err
+	}
+	for _, name := range r.Secrets {
+		found := false
+		for _, secret := range c.Secrets {
+			found = found || secret.Name == name
+		}
+		if !found {
+			return fmt.Errorf("unknown secret %q", name)
+		}
+	}
+	for _, pattern := range append(append(append([]string{}, r.Match.Projects...), r.Match.Refs...), r.Match.Environments...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %s", pattern, err)
+		}
+	}
+	if err := checkLocale(r.Locale); err != nil {
+		return err
+	}
+	switch r.Template {
+	case "":
+		r.Template = TemplateMarkdown
+	case TemplateMarkdown, TemplateText, TemplateCard:
+	default:
+		if _, ok := c.templates[r.Template]; ok {
+			break
+		}
+		return fmt.Errorf("unknown template %q", r.Template)
+	}
+	return nil
+}
+
+func (r *Route) match(secret *SecretConfig, event *Event) bool {
+	if len(r.Secrets) > 0 && !contains(r.Secrets, secret.Name) {
+		return false
+	}
+	m := r.Match
+	if len(m.Events) > 0 && !contains(m.Events, event.Kind) && !contains(m.Events, event.ObjectKind) {
+		return false
+	}
+	if len(m.Projects) > 0 && !matchAny(m.Projects, event.ProjectPath) {
+		return false
+	}
+	if len(m.Refs) > 0 && !matchAny(m.Refs, event.Ref) {
+		return false
+	}
+	if len(m.Authors) > 0 && !contains(m.Authors, event.AuthorUsername) && !contains(m.Authors, event.Author) && !contains(m.Authors, event.AuthorEmail) {
+		return false
+	}
+	if len(m.Environments) > 0 && !matchAny(m.Environments, event.Environment) {
+		return false
+	}
+	if len(m.Tiers) > 0 && !contains(m.Tiers, event.EnvironmentTier) {
+		return false
+	}
+	if len(m.Labels) > 0 {
+		found := false
+		for _, label := range event.Labels {
+			found = found || contains(m.Labels, label)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Targets returns the destinations of the secret followed by those of every matching route
+func (c *Config) Targets(secret *SecretConfig, event *Event) []Target {
+	targets := []Target{}
+	seen := map[string]int{}
+	add := func(names []string, template, locale string, recipients []string, split bool) {
+		if len(locale) == 0 {
+			locale = c.Locale
+		}
+		for _, name := range names {
+			key := name + "\x00" + template + "\x00" + locale
+			// the same destination matched twice is sent once to all the recipients
+			if i, ok := seen[key]; ok {
+				targets[i].Split = targets[i].Split || split
+				for _, recipient := range recipients {
+					if !contains(targets[i].Recipients, recipient) {
+						targets[i].Recipients = append(targets[i].Recipients, recipient)
+					}
+				}
+				continue
+			}
+			seen[key] = len(targets)
+			renderer, ok := c.templates[template]
+			if !ok {
+				renderer = defaultTemplate
+			}
+			renderer = renderer.withLocale(locale)
+			targets = append(targets, Target{Name: name, Notifier: c.notifiers[name], Template: template, Recipients: append([]string{}, recipients...), Split: split, Locale: locale, Renderer: renderer})
+		}
+	}
+	add(secret.Destinations, TemplateMarkdown, "", nil, false)
+	for _, route := range c.Routes {
+		if route.match(secret, event) {
+			add(route.Destinations, route.Template, route.Locale, route.Recipients, route.Split)
+		}
+	}
+	return targets
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shortRef strips refs/heads/ and refs/tags/
+func shortRef(ref string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+}
@@ -0,0 +1,49 @@
+package main
+
+// samplePayloads a payload of each supported X-Gitlab-Event, to validate and preview the templates
+var samplePayloads = map[string]string{
+	"Push Hook": `{"object_kind":"push","before":"95790bf891e76fee5e1747ab589903a6a1f80f22","after":"da1560886d4f094c3e6c9ef40349f7d38b5d27d7","ref":"refs/heads/master","user_name":"John Smith","user_username":"jsmith","user_email":"john@example.com","total_commits_count":2,
+		"project":{"name":"Diaspora","path_with_namespace":"mike/diaspora","web_url":"http://example.com/mike/diaspora"},"repository":{"name":"Diaspora","homepage":"http://example.com/mike/diaspora"},
+		"commits":[{"id":"b6568db1bc1dcd7f8b4d5a946b0b91f9dacd7327","message":"Update Catalan translation to e38cb41.\n","timestamp":"2011-12-12T14:27:31+02:00","url":"http://example.com/mike/diaspora/commit/b6568db1bc1dcd7f8b4d5a946b0b91f9dacd7327","author":{"name":"Jordi Mallach","email":"jordi@softcatala.org"}},
+		{"id":"da1560886d4f094c3e6c9ef40349f7d38b5d27d7","message":":bug: fixed readme","timestamp":"2012-01-03T23:36:29+02:00","url":"http://example.com/mike/diaspora/commit/da1560886d4f094c3e6c9ef40349f7d38b5d27d7","author":{"name":"GitLab dev user","email":"gitlabdev@dv6700.(none)"}}]}`,
+	"Tag Push Hook": `{"object_kind":"tag_push","ref":"refs/tags/v1.0.0","user_name":"John Smith","user_username":"jsmith","user_email":"john@example.com",
+		"project":{"name":"Example","path_with_namespace":"jsmith/example","web_url":"http://example.com/jsmith/example"},"repository":{"name":"Example","homepage":"http://example.com/jsmith/example"}}`,
+	"Issue Hook": `{"object_kind":"issue","user":{"name":"Administrator","username":"root","email":"admin@example.com"},
+		"project":{"name":"Gitlab Test","path_with_namespace":"gitlabhq/gitlab-test","web_url":"http://example.com/gitlabhq/gitlab-test"},"repository":{"name":"Gitlab Test"},
+		"object_attributes":{"id":301,"title":"New API: create/update/delete file","url":"http://example.com/diaspora/issues/23","action":"open"},"labels":[{"title":"API"}]}`,
+	"Note Hook": `{"object_kind":"note","user":{"name":"Administrator","username":"root","email":"admin@example.com"},
+		"project":{"name":"Gitlab Test","path_with_namespace":"gitlabhq/gitlab-test","web_url":"http://example.com/gitlabhq/gitlab-test"},"repository":{"name":"Gitlab Test"},
+		"object_attributes":{"id":1243,"note":"This is a commit comment. How does this work?","updated_at":"2015-05-17 18:08:09 UTC","url":"http://example.com/gitlab-org/gitlab-test/commit/cfe32cf61b73a0d5e9f13e774abde7ff789b1660#note_1243"}}`,
+	"Merge Request Hook": `{"object_kind":"merge_request","user":{"name":"Administrator","username":"root","email":"admin@example.com"},
+		"project":{"name":"Gitlab Test","path_with_namespace":"gitlabhq/gitlab-test","web_url":"http://example.com/gitlabhq/gitlab-test"},"repository":{"name":"Gitlab Test"},
+		"object_attributes":{"id":99,"title":"MS-Viewport","target_branch":"master","source_branch":"ms-viewport","url":"http://example.com/diaspora/merge_requests/1","action":"open","updated_at":"2013-12-03 17:23:34 UTC"},
+		"labels":[{"title":"API"}],"assignees":[{"name":"User1","username":"user1","email":"user1@example.com"}],"reviewers":[{"name":"User2","username":"user2","email":"user2@example.com"}]}`,
+	"Pipeline Hook": `{"object_kind":"pipeline","object_attributes":{"id":31,"ref":"master","tag":false,"status":"failed","created_at":"2016-08-12 15:23:28 UTC","finished_at":"2016-08-12 15:26:29 UTC","duration":63},
+		"user":{"name":"Administrator","username":"root","email":"admin@example.com"},
+		"project":{"name":"Gitlab Test","path_with_namespace":"gitlab-org/gitlab-test","web_url":"http://example.com/gitlab-org/gitlab-test"}}`,
+	"Job Hook": `{"object_kind":"build","ref":"gitlab-script-trigger","tag":false,"build_id":1977,"build_name":"test","build_stage":"test","build_status":"failed","build_created_at":"2021-02-23T02:41:37.886Z","build_finished_at":"2021-02-23T02:43:12.026Z","build_duration":94.14,"build_allow_failure":false,"build_failure_reason":"script_failure",
+		"runner":{"id":380987,"description":"shared-runners-manager-6.gitlab.com"},"user":{"name":"User","username":"user","email":"user@gitlab.com"},
+		"repository":{"name":"gitlab_test","homepage":"http://192.168.64.1:3005/gitlab-org/gitlab-test"},"project":{"name":"Gitlab Test","path_with_namespace":"gitlab-org/gitlab-test","web_url":"http://192.168.64.1:3005/gitlab-org/gitlab-test"}}`,
+	"Deployment Hook": `{"object_kind":"deployment","status":"success","status_changed_at":"2021-04-28 21:50:00 +0200","deployment_id":15,"deployable_id":796,"deployable_url":"http://10.126.0.2:3000/root/test-deployment-webhooks/-/jobs/796",
+		"environment":"production","environment_tier":"production","environment_slug":"production","environment_external_url":"https://example.com","short_sha":"a3d1b0f3","ref":"v1.4.2","user":{"name":"Administrator","username":"root","email":"admin@example.com"},
+		"commit_url":"http://10.126.0.2:3000/root/test-deployment-webhooks/-/commit/a3d1b0f3a3d1b0f3a3d1b0f3a3d1b0f3a3d1b0f3","commit_title":"Add new file",
+		"project":{"name":"test-deployment-webhooks","path_with_namespace":"root/test-deployment-webhooks","web_url":"http://10.126.0.2:3000/root/test-deployment-webhooks"}}`,
+	"Release Hook": `{"object_kind":"release","id":1,"created_at":"2020-11-02 12:55:12 UTC","description":"v1.1 has been released","name":"v1.1","released_at":"2020-11-02 12:55:12 UTC","tag":"v1.1","action":"create","url":"https://example.com/gitlab-org/release-webhook-example/-/releases/v1.1",
+		"assets":{"count":2,"links":[{"id":1,"external":true,"link_type":"other","name":"Changelog","url":"https://example.net/changelog"}],"sources":[{"format":"zip","url":"https://example.com/gitlab-org/release-webhook-example/-/archive/v1.1/release-webhook-example-v1.1.zip"}]},
+		"commit":{"id":"ee0a3fb31ac16e11b9dbb596ad16d4af654d08f8","message":"Release v1.1","title":"Release v1.1","timestamp":"2020-10-31T14:58:32+11:00","url":"https://example.com/gitlab-org/release-webhook-example/-/commit/ee0a3fb31ac16e11b9dbb596ad16d4af654d08f8","author":{"name":"Example User","email":"user@example.com"}},
+		"project":{"name":"release-webhook-example","path_with_namespace":"gitlab-org/release-webhook-example","web_url":"https://example.com/gitlab-org/release-webhook-example"}}`,
+}
+
+// sampleEvent the sample event of the object kind or of the X-Gitlab-Event, nil when there is none
+func sampleEvent(kind string) *Event {
+	for name, payload := range samplePayloads {
+		event, err := parseEvent(name, []byte(payload))
+		if err != nil {
+			panic(err)
+		}
+		if name == kind || event.ObjectKind == kind {
+			return event
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type SlackConfig struct {
+	Webhook string `json:"webhook" yaml:"webhook"`
+}
+
+// Slack incoming webhook, events are rendered as Block Kit blocks
+type Slack struct {
+	cfg    *SlackConfig
+	client *http.Client
+}
+
+type slackMsg struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string        `json:"type"`
+	Text     *slackText    `json:"text,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackElement struct {
+	Type  string     `json:"type"`
+	Text  *slackText `json:"text,omitempty"`
+	URL   string     `json:"url,omitempty"`
+	Style string     `json:"style,omitempty"`
+}
+
+func NewSlack(cfg *SlackConfig) (*Slack, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("slack.webhook is empty")
+	}
+	return &Slack{cfg: cfg, client: NewClient()}, nil
+}
+
+func (s *Slack) Markup() *Markup {
+	return SlackMarkup
+}
+
+// Limit the text of a section block
+func (s *Slack) Limit(msg *Message) int {
+	return 3000
+}
+
+// slackTime formats the time with the reader's timezone
+func slackTime(t string) string {
+	if parsed, ok := parseTime(t); ok {
+		return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", parsed.Unix(), escapeEntities(t))
+	}
+	return escapeEntities(t)
+}
+
+func buildSlackMsg(msg *Message) *slackMsg {
+	if msg.Event == nil || !msg.Markdown {
+		return &slackMsg{Text: msg.Content}
+	}
+	e := msg.Event
+	body := &slackMsg{Text: escapeEntities(e.Project + ": " + e.Summary())}
+	body.Blocks = append(body.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: msg.Content}})
+	context := []string{escapeEntities(e.ProjectPath)}
+	if t := e.Time(); len(t) > 0 {
+		context = append(context, slackTime(t))
+	}
+	body.Blocks = append(body.Blocks, slackBlock{Type: "context", Elements: []interface{}{slackText{Type: "mrkdwn", Text: strings.Join(context, " · ")}}})
+	if len(e.URL) > 0 {
+		button := slackElement{Type: "button", Text: &slackText{Type: "plain_text", Text: actionText(e)}, URL: e.URL}
+		if e.Status == "failed" {
+			button.Style = "danger"
+		}
+		body.Blocks = append(body.Blocks, slackBlock{Type: "actions", Elements: []interface{}{button}})
+	}
+	return body
+}
+
+func (s *Slack) Send(msg *Message) (*WxResp, error) {
+	data, err := json.Marshal(buildSlackMsg(msg))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post(s.cfg.Webhook, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request slack webhook err: %s", err)
+	}
+	defer resp.Body.Close()
+	// slack answers with plain text, `ok` or the error
+	text, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return statusResp(resp, text)
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: string(text)}, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// teams rejects payloads larger than 28KB
+const teamsMaxPayload = 28 * 1024
+
+type TeamsConfig struct {
+	Webhook string `json:"webhook" yaml:"webhook"`
+}
+
+// Teams incoming webhook, events are sent as adaptive cards
+type Teams struct {
+	cfg    *TeamsConfig
+	client *http.Client
+}
+
+type teamsMsg struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string     `json:"contentType"`
+	Content     *teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string        `json:"$schema"`
+	Type    string        `json:"type"`
+	Version string        `json:"version"`
+	Body    []interface{} `json:"body"`
+	Actions []teamsAction `json:"actions,omitempty"`
+}
+
+type teamsTextBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Size     string `json:"size,omitempty"`
+	Weight   string `json:"weight,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Wrap     bool   `json:"wrap"`
+	IsSubtle bool   `json:"isSubtle,omitempty"`
+}
+
+type teamsFactSet struct {
+	Type  string      `json:"type"`
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// teamsColors the title color of each pipeline status
+var teamsColors = map[string]string{
+	"success": "Good",
+	"failed":  "Attention",
+	"running": "Accent",
+	"pending": "Warning",
+}
+
+func NewTeams(cfg *TeamsConfig) (*Teams, error) {
+	if len(cfg.Webhook) == 0 {
+		return nil, fmt.Errorf("teams.webhook is empty")
+	}
+	return &Teams{cfg: cfg, client: NewClient()}, nil
+}
+
+func (t *Teams) Markup() *Markup {
+	return SimpleMarkup
+}
+
+// Limit buildTeamsMsg trims the body on its own as the whole payload is limited
+func (t *Teams) Limit(msg *Message) int {
+	return 0
+}
+
+// buildTeamsCard builds the card of the event with body as its main text
+func buildTeamsCard(e *Event, body string) *teamsCard {
+	card := &teamsCard{Schema: "http://adaptivecards.io/schemas/adaptive-card.json", Type: "AdaptiveCard", Version: "1.4"}
+	card.Body = append(card.Body,
+		teamsTextBlock{Type: "TextBlock", Text: e.Project, Size: "Medium", Weight: "Bolder", Color: teamsColors[e.Status], Wrap: true},
+		teamsTextBlock{Type: "TextBlock", Text: e.Summary(), Wrap: true, IsSubtle: true},
+	)
+	facts := []teamsFact{}
+	addFact := func(title, value string) {
+		if len(value) > 0 {
+			facts = append(facts, teamsFact{Title: title, Value: value})
+		}
+	}
+	addFact(e.tr("Project"), e.ProjectPath)
+	if len(e.SourceBranch) > 0 {
+		addFact(e.tr("Ref"), e.SourceBranch+" → "+e.TargetBranch)
+	} else {
+		addFact(e.tr("Ref"), e.Ref)
+	}
+	addFact(e.tr("Status"), e.tr(e.Status))
+	addFact(e.tr("Duration"), formatDuration(e.Duration))
+	addFact(e.tr("Author"), e.Author)
+	card.Body = append(card.Body, teamsFactSet{Type: "FactSet", Facts: facts})
+	if len(body) > 0 {
+		card.Body = append(card.Body, teamsTextBlock{Type: "TextBlock", Text: body, Wrap: true})
+	}
+	if len(e.URL) > 0 {
+		card.Actions = append(card.Actions, teamsAction{Type: "Action.OpenUrl", Title: actionText(e), URL: e.URL})
+	}
+	return card
+}
+
+func marshalTeamsCard(card *teamsCard) ([]byte, error) {
+	return json.Marshal(&teamsMsg{Type: "message", Attachments: []teamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}}})
+}
+
+// buildTeamsMsg renders the body with the template of the message and trims it until the payload fits into teams' limit
+func buildTeamsMsg(msg *Message) ([]byte, error) {
+	if msg.Event == nil || !msg.Markdown {
+		card := &teamsCard{Schema: "http://adaptivecards.io/schemas/adaptive-card.json", Type: "AdaptiveCard", Version: "1.4"}
+		card.Body = append(card.Body, teamsTextBlock{Type: "TextBlock", Text: msg.Content, Wrap: true})
+		return marshalTeamsCard(card)
+	}
+	r := msg.template()
+	render := func(e *Event) string { return trans2Emoji(r.Body(e, SimpleMarkup)) }
+	event, body := msg.Event, render(msg.Event)
+	limit := len(body)
+	for {
+		data, err := marshalTeamsCard(buildTeamsCard(event, body))
+		if err != nil || len(data) <= teamsMaxPayload || limit == 0 {
+			return data, err
+		}
+		// the body is shortened by what the payload is over, escaping may take another round
+		if limit -= len(data) - teamsMaxPayload; limit < 0 {
+			limit = 0
+		}
+		event, body = fitEvent(msg.Event, render, limit)
+	}
+}
+
+func (t *Teams) Send(msg *Message) (*WxResp, error) {
+	data, err := buildTeamsMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Post(t.cfg.Webhook, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request teams webhook err: %s", err)
+	}
+	defer resp.Body.Close()
+	text, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusResp(resp, text)
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+}
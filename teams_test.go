@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func teamsPayload(t *testing.T, event *Event, renderer *EventTemplate) string {
+	teams, _ := NewTeams(&TeamsConfig{Webhook: "http://teams"})
+	target := Target{Name: "teams", Notifier: teams, Template: TemplateMarkdown, Renderer: renderer}
+	msgs := target.messages(event, nil)
+	data, err := buildTeamsMsg(msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTeamsUsesTemplate(t *testing.T) {
+	renderer, err := parseTemplate("custom", TemplateConfig{"push": "custom body of {{.Author}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := teamsPayload(t, sampleEvent("push"), renderer); !strings.Contains(data, "custom body of John Smith") {
+		t.Errorf("the route template is not used: %s", data)
+	}
+	if data := teamsPayload(t, sampleEvent("push"), defaultTemplate.withLocale("zh-CN")); !strings.Contains(data, "推送到") {
+		t.Errorf("the locale is not used: %s", data)
+	}
+}
+
+func TestTeamsEventDetails(t *testing.T) {
+	for kind, details := range map[string][]string{
+		"release":    {"v1.1 has been released", "https://example.net/changelog"},
+		"build":      {"script_failure", "shared-runners-manager-6.gitlab.com"},
+		"deployment": {"https://example.com"},
+	} {
+		data := teamsPayload(t, sampleEvent(kind), defaultTemplate)
+		for _, detail := range details {
+			if !strings.Contains(data, detail) {
+				t.Errorf("%s: %q is missing from %s", kind, detail, data)
+			}
+		}
+	}
+}
+
+func TestTeamsTrimsLongBody(t *testing.T) {
+	note := sampleEvent("note")
+	note.Note = strings.Repeat("a \"long\" <note> ", 5000)
+	release := sampleEvent("release")
+	release.Description = strings.Repeat("* a long release note\n", 3000)
+	push := sampleEvent("push")
+	for len(push.Commits) < 2000 {
+		push.Commits = append(push.Commits, push.Commits[0])
+	}
+	for _, event := range []*Event{note, release, push} {
+		if data := teamsPayload(t, event, defaultTemplate); len(data) > teamsMaxPayload {
+			t.Errorf("%s: payload of %d bytes, want at most %d", event.ObjectKind, len(data), teamsMaxPayload)
+		}
+	}
+}
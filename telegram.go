@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+type TelegramConfig struct {
+	Token           string `json:"token" yaml:"token"`
+	ChatID          string `json:"chat_id" yaml:"chat_id"`
+	MessageThreadID int64  `json:"message_thread_id" yaml:"message_thread_id"`
+	APIURL          string `json:"api_url" yaml:"api_url"`
+}
+
+// Telegram bot api, message_thread_id sends to a topic of a forum group
+type Telegram struct {
+	cfg    *TelegramConfig
+	client *http.Client
+}
+
+type telegramMsg struct {
+	ChatID                string `json:"chat_id"`
+	MessageThreadID       int64  `json:"message_thread_id,omitempty"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResp struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int64  `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int64 `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func NewTelegram(cfg *TelegramConfig) (*Telegram, error) {
+	if len(cfg.Token) == 0 {
+		return nil, fmt.Errorf("telegram.token is empty")
+	}
+	if len(cfg.ChatID) == 0 {
+		return nil, fmt.Errorf("telegram.chat_id is empty")
+	}
+	if len(cfg.APIURL) == 0 {
+		cfg.APIURL = telegramAPI
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	return &Telegram{cfg: cfg, client: NewClient()}, nil
+}
+
+func (t *Telegram) Markup() *Markup {
+	return HTMLMarkup
+}
+
+// Limit telegram counts characters, bytes are stricter
+func (t *Telegram) Limit(msg *Message) int {
+	return 4096
+}
+
+func (t *Telegram) Send(msg *Message) (*WxResp, error) {
+	body := &telegramMsg{ChatID: t.cfg.ChatID, MessageThreadID: t.cfg.MessageThreadID, Text: msg.Content, ParseMode: "HTML", DisableWebPagePreview: true}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Post(fmt.Sprintf("%s/bot%s/sendMessage", t.cfg.APIURL, t.cfg.Token), "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		// the url holds the bot token
+		return nil, fmt.Errorf("Request telegram bot err: %s", strings.ReplaceAll(err.Error(), t.cfg.Token, "<token>"))
+	}
+	defer resp.Body.Close()
+	telegramResp := &telegramResp{}
+	if err = json.NewDecoder(resp.Body).Decode(telegramResp); err != nil {
+		return nil, fmt.Errorf("Decode telegram response err: %s, status %d", err, resp.StatusCode)
+	}
+	if telegramResp.Ok {
+		return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+	}
+	if telegramResp.ErrorCode == http.StatusTooManyRequests {
+		return nil, &RetryError{After: time.Duration(telegramResp.Parameters.RetryAfter) * time.Second, Msg: telegramResp.Description}
+	}
+	return &WxResp{ErrCode: telegramResp.ErrorCode, ErrMsg: telegramResp.Description}, nil
+}
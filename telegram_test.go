@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTelegramSend(t *testing.T) {
+	requests := []*telegramMsg{}
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &telegramMsg{}
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			t.Errorf("decode request: %s", err)
+		}
+		requests = append(requests, body)
+		paths = append(paths, r.URL.Path)
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 3","parameters":{"retry_after":3}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer server.Close()
+	telegram, err := NewTelegram(&TelegramConfig{Token: "123:abc", ChatID: "-100", MessageThreadID: 42, APIURL: server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := sampleEvent("issue")
+	event.Title = "a <b> & c"
+	target := Target{Name: "telegram", Notifier: telegram, Template: TemplateMarkdown, Renderer: defaultTemplate}
+	msg := target.messages(event, nil)[0]
+	if !strings.Contains(msg.Content, "a &lt;b&gt; &amp; c") || strings.Contains(msg.Content, "<b> & c") {
+		t.Fatalf("content %q, want the title escaped", msg.Content)
+	}
+	_, err = telegram.Send(msg)
+	retry, ok := err.(*RetryError)
+	if !ok {
+		t.Fatalf("err %v, want a RetryError", err)
+	}
+	if retry.After != 3*time.Second {
+		t.Errorf("retry after %s, want 3s", retry.After)
+	}
+	resp, err := telegram.Send(msg)
+	if err != nil || resp.ErrCode != 0 {
+		t.Fatalf("send: %v %v", resp, err)
+	}
+	for i, body := range requests {
+		if paths[i] != "/bot123:abc/sendMessage" {
+			t.Errorf("path %q", paths[i])
+		}
+		if body.ChatID != "-100" || body.MessageThreadID != 42 || body.ParseMode != "HTML" || body.Text != msg.Content {
+			t.Errorf("request %+v", body)
+		}
+	}
+}
+
+func TestTelegramErrorHidesToken(t *testing.T) {
+	telegram, _ := NewTelegram(&TelegramConfig{Token: "123:secret", ChatID: "-100", APIURL: "http://127.0.0.1:1"})
+	_, err := telegram.Send(&Message{Content: "hello"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("err %v, want an error without the token", err)
+	}
+}
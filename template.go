@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinTemplates the body of each object kind, the project heading is added by Render
+var builtinTemplates = map[string]string{
+	"push": `{{heading 3 (print "On branch " (code (escape .RawRef)))}}
+{{range .Commits}}{{escape .Author}} push a commit {{link (escape (oneline .Message)) .Url}}  {{escape .TimeStamp}}
+{{end}}{{if .MoreCommits}}{{$more := escape (printf "... and %d more commits" .MoreCommits)}}{{if .CompareURL}}{{link $more .CompareURL}}{{else}}{{$more}}{{end}}
+{{end}}{{if .Removed}}{{escape .Author}} {{code "remove"}} it{{end}}`,
+	"tag_push":      `{{escape .Author}} push a tag: {{link (escape .RawRef) .URL}}`,
+	"issue":         `{{escape .Author}} {{escape .Action}} a issue {{link (escape .Title) .URL}}`,
+	"note":          `{{escape .Author}} leave a comment: {{escape .Note}}  {{escape .UpdatedAt}} ` + "\n" + `{{link (escape "Detail>>") .URL}}`,
+	"merge_request": `{{escape .Author}} {{code (escape .Action)}} a merge request from {{code (escape .SourceBranch)}} to {{code (escape .TargetBranch)}} ` + "\n" + `{{link (escape "Detail>>") .URL}}`,
+	"pipeline": `{{heading 3 (print "Pipeline on " .RefType " " (code (escape .Ref)))}}
+{{code "Status"}}: {{status .Status}}
+{{code "Start at"}}: {{escape .CreatedAt}}
+{{if .FinishedAt}}{{code "Finish at"}}: {{escape .FinishedAt}}
+{{end}}{{if gt .Duration 0}}{{code "Duration"}}: {{.Duration}}s{{end}}`,
+	"build": `{{heading 3 (print "Job " (code (escape .Job)) " on " .RefType " " (code (escape .Ref)))}}
+{{code "Status"}}: {{status .Status}}
+{{code "Stage"}}: {{escape .Stage}}
+{{if .FailureReason}}{{code "Reason"}}: {{escape .FailureReason}}
+{{end}}{{if .Runner}}{{code "Runner"}}: {{escape .Runner}}
+{{end}}{{if gt .Duration 0}}{{code "Duration"}}: {{.Duration}}s
+{{end}}{{link (escape "Detail>>") .URL}}`,
+	"deployment": `{{heading 3 (print (code (escape .Ref)) " " .Deployed " " (code (escape .Environment)) " by " (escape .Author))}}
+{{range .Commits}}{{link (escape .Id) .Url}} {{escape (firstline .Message)}}
+{{end}}{{if .EnvironmentURL}}{{link (escape .EnvironmentURL) .EnvironmentURL}}
+{{end}}{{link (escape "Detail>>") .URL}}`,
+	"release": `{{heading 3 (print "Release " (link (escape .Title) .URL) " " (code (escape .Action)))}}
+{{code "Tag"}}: {{escape .Ref}}
+{{if .Description}}{{escape (excerpt 500 .Description)}}
+{{end}}{{range .Assets}}{{link (escape .Name) .URL}}
+{{end}}`,
+}
+
+var defaultTemplate = mustEventTemplate("default", builtinTemplates)
+
+// TemplateConfig the text/template of each object kind, the kinds left out use the builtin templates
+type TemplateConfig map[string]string
+
+// EventTemplate renders the body of the events, the markup helpers are those of the backend,
+// the kinds it has no template for are rendered by fallback, the builtin templates of its locale
+type EventTemplate struct {
+	name     string
+	kinds    map[string]*template.Template
+	locale   string
+	fallback *EventTemplate
+}
+
+// templateFuncs the helpers available to the templates
+func templateFuncs(m *Markup, locale string) template.FuncMap {
+	return template.FuncMap{
+		"tr":        func(s string) string { return translate(locale, s) },
+		"heading":   m.Heading,
+		"link":      m.Link,
+		"bold":      m.Bold,
+		"code":      m.Code,
+		"escape":    m.Escape,
+		"emoji":     trans2Emoji,
+		"truncate":  func(n int, s string) string { return truncateRunes(s, n) },
+		"excerpt":   excerpt,
+		"shortsha":  shortSHA,
+		"reltime":   relativeTime,
+		"mdescape":  markdownEscape,
+		"oneline":   func(s string) string { return strings.ReplaceAll(s, "\n", "") },
+		"firstline": firstLine,
+		"duration":  formatDuration,
+		"status":    func(s string) string { return pipelineStatusEmoji[s] },
+		"join":      strings.Join,
+	}
+}
+
+func mustEventTemplate(name string, kinds map[string]string) *EventTemplate {
+	t, err := newEventTemplate(name, kinds)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func newEventTemplate(name string, kinds map[string]string) (*EventTemplate, error) {
+	t := &EventTemplate{name: name, kinds: map[string]*template.Template{}}
+	for kind, text := range kinds {
+		tpl, err := template.New(name + "/" + kind).Funcs(templateFuncs(PlainMarkup, "")).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		t.kinds[kind] = tpl
+	}
+	return t, nil
+}
+
+// parseTemplate parses the templates of the config and renders every one against the sample of its kind
+func parseTemplate(name string, cfg TemplateConfig) (*EventTemplate, error) {
+	for kind := range cfg {
+		if _, ok := builtinTemplates[kind]; !ok {
+			return nil, fmt.Errorf("unknown event kind %q", kind)
+		}
+	}
+	t, err := newEventTemplate(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.fallback = defaultTemplate
+	for kind := range cfg {
+		for _, m := range markups {
+			if _, err = t.execute(kind, sampleEvent(kind), m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// withLocale the template translating with the locale and falling back to the builtin templates of the locale
+func (t *EventTemplate) withLocale(locale string) *EventTemplate {
+	if len(locale) == 0 {
+		return t
+	}
+	if t.fallback == nil {
+		return localeTemplates[locale]
+	}
+	return &EventTemplate{name: t.name, kinds: t.kinds, locale: locale, fallback: localeTemplates[locale]}
+}
+
+func (t *EventTemplate) execute(kind string, e *Event, m *Markup) (string, error) {
+	tpl, ok := t.kinds[kind]
+	if !ok {
+		return "", nil
+	}
+	// the funcs are replaced on a clone as the template is shared by the requests
+	tpl, err := tpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = tpl.Funcs(templateFuncs(m, t.locale)).Execute(buf, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Body renders the event without the project heading, a failed template falls back to the builtin one
+func (t *EventTemplate) Body(e *Event, m *Markup) string {
+	if _, ok := t.kinds[e.ObjectKind]; !ok && t.fallback != nil {
+		t = t.fallback
+	}
+	content, err := t.execute(e.ObjectKind, e, m)
+	if err != nil && t.fallback != nil {
+		log.Printf("Render template %s err: %s", t.name, err)
+		content, _ = t.fallback.execute(e.ObjectKind, e, m)
+	}
+	return content
+}
+
+// Render renders the event with a project heading
+func (t *EventTemplate) Render(e *Event, m *Markup) string {
+	body := t.Body(e, m)
+	if len(body) == 0 {
+		return ""
+	}
+	return trans2Emoji(m.Heading(1, m.Escape(e.Project)) + "\n" + body)
+}
+
+// excerpt the whole lines of s within n runes, so that the markdown of a line is never cut
+func excerpt(n int, s string) string {
+	if runeLen(s) <= n {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	size := 0
+	for i, line := range lines {
+		if size += runeLen(line) + 1; size > n {
+			if i == 0 {
+				return truncateRunes(line, n)
+			}
+			return strings.Join(lines[:i], "\n") + "\n..."
+		}
+	}
+	return s
+}
+
+func shortSHA(s string) string {
+	if len(s) > 8 {
+		return s[:8]
+	}
+	return s
+}
+
+// relativeTime formats the time as 5 minutes ago
+func relativeTime(s string) string {
+	t, ok := parseTime(s)
+	if !ok {
+		return s
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	}
+	return plural(int(d/(24*time.Hour)), "day") + " ago"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// markdownEscape escapes the characters starting markdown emphasis, code and links
+func markdownEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`).Replace(s)
+}
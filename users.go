@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserConfig maps a gitlab user, by username or email, to the accounts of the chat backends
+type UserConfig struct {
+	Username string `json:"username" yaml:"username"`
+	Email    string `json:"email" yaml:"email"`
+	WeComID  string `json:"wecom_userid" yaml:"wecom_userid"`
+	Mobile   string `json:"mobile" yaml:"mobile"`
+}
+
+func (u *UserConfig) validate() error {
+	if len(u.Username) == 0 && len(u.Email) == 0 {
+		return fmt.Errorf("username and email are empty")
+	}
+	if len(u.WeComID) == 0 && len(u.Mobile) == 0 {
+		return fmt.Errorf("wecom_userid and mobile are empty")
+	}
+	return nil
+}
+
+// lookupUser finds the user by gitlab username first, then by email
+func (c *Config) lookupUser(user EventUser) *UserConfig {
+	for _, u := range c.Users {
+		if len(u.Username) > 0 && u.Username == user.Username {
+			return u
+		}
+	}
+	for _, u := range c.Users {
+		if len(u.Email) > 0 && strings.EqualFold(u.Email, user.Email) {
+			return u
+		}
+	}
+	return nil
+}
+
+// mentions the configured users among those the event should notify
+func (c *Config) mentions(e *Event) []*UserConfig {
+	users := []*UserConfig{}
+	for _, user := range e.Mentions {
+		u := c.lookupUser(user)
+		if u == nil {
+			continue
+		}
+		found := false
+		for _, v := range users {
+			found = found || v == u
+		}
+		if !found {
+			users = append(users, u)
+		}
+	}
+	return users
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultWebhookBody      = `{"event": {{json .Event}}, "title": {{json .Title}}, "content": {{json .Content}}}`
+	defaultSignatureHeader  = "X-Gitlabot-Signature"
+	webhookErrCodeTemplate  = -1
+	webhookMaxResponseBytes = 512
+)
+
+// WebhookConfig a generic http request, Body is a text/template rendering json
+type WebhookConfig struct {
+	URL             string            `json:"url" yaml:"url"`
+	Method          string            `json:"method" yaml:"method"`
+	Headers         map[string]string `json:"headers" yaml:"headers"`
+	Body            string            `json:"body" yaml:"body"`
+	Secret          string            `json:"secret" yaml:"secret"`
+	SignatureHeader string            `json:"signature_header" yaml:"signature_header"`
+}
+
+// Webhook forwards the normalized event to any http endpoint, signed with HMAC-SHA256 when Secret is set
+type Webhook struct {
+	cfg    *WebhookConfig
+	body   *template.Template
+	client *http.Client
+}
+
+// webhookData the data of the body template
+type webhookData struct {
+	Event   *Event
+	Title   string
+	Content string
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func NewWebhook(cfg *WebhookConfig) (*Webhook, error) {
+	if len(cfg.URL) == 0 {
+		return nil, fmt.Errorf("webhook.url is empty")
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("webhook.method must be POST, PUT or PATCH")
+	}
+	if len(cfg.Body) == 0 {
+		cfg.Body = defaultWebhookBody
+	}
+	if len(cfg.SignatureHeader) == 0 {
+		cfg.SignatureHeader = defaultSignatureHeader
+	}
+	body, err := template.New("body").Funcs(webhookFuncs).Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("webhook.body: %s", err)
+	}
+	return &Webhook{cfg: cfg, body: body, client: NewClient()}, nil
+}
+
+func (w *Webhook) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+func (w *Webhook) Limit(msg *Message) int {
+	return 0
+}
+
+// sign returns sha256=hex(HmacSHA256(secret, body))
+func (w *Webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.cfg.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Send(msg *Message) (*WxResp, error) {
+	buf := &bytes.Buffer{}
+	if err := w.body.Execute(buf, &webhookData{Event: msg.Event, Title: msg.Title, Content: msg.Content}); err != nil {
+		return &WxResp{ErrCode: webhookErrCodeTemplate, ErrMsg: fmt.Sprintf("Render webhook body err: %s", err)}, nil
+	}
+	data := buf.Bytes()
+	if !json.Valid(data) {
+		return &WxResp{ErrCode: webhookErrCodeTemplate, ErrMsg: "Webhook body is not valid json"}, nil
+	}
+	req, err := http.NewRequest(w.cfg.Method, w.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	if len(w.cfg.Secret) > 0 {
+		req.Header.Set(w.cfg.SignatureHeader, w.sign(data))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Request webhook err: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBytes))
+		return statusResp(resp, text)
+	}
+	return &WxResp{ErrCode: 0, ErrMsg: "ok"}, nil
+}
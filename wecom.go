@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	weComURL = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send"
+	// wecomRateLimit the messages a group robot takes per minute
+	wecomRateLimit = 20
+)
+
+type WeComConfig struct {
+	Key string `json:"key" yaml:"key"`
+	// URL overrides the webhook url, e.g. for a proxy
+	URL string `json:"url" yaml:"url"`
+	// MsgType markdown or markdown_v2, used when the route template is markdown
+	MsgType string `json:"msgtype" yaml:"msgtype"`
+}
+
+// WeCom group robot
+type WeCom struct {
+	cfg    *WeComConfig
+	url    string
+	client *http.Client
+}
+
+// wxMsg the body of a group robot message, exactly one of the payloads is set according to MsgType
+type wxMsg struct {
+	MsgType      string          `json:"msgtype"`
+	Text         *wxText         `json:"text,omitempty"`
+	Markdown     *wxMarkdown     `json:"markdown,omitempty"`
+	MarkdownV2   *wxMarkdown     `json:"markdown_v2,omitempty"`
+	News         *wxNews         `json:"news,omitempty"`
+	Image        *wxImage        `json:"image,omitempty"`
+	File         *wxFile         `json:"file,omitempty"`
+	TemplateCard *wxTemplateCard `json:"template_card,omitempty"`
+}
+
+type wxText struct {
+	Content             string   `json:"content"`
+	MentionedList       []string `json:"mentioned_list,omitempty"`
+	MentionedMobileList []string `json:"mentioned_mobile_list,omitempty"`
+}
+
+type wxMarkdown struct {
+	Content string `json:"content"`
+}
+
+type wxNews struct {
+	Articles []wxArticle `json:"articles"`
+}
+
+type wxArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+	PicURL      string `json:"picurl,omitempty"`
+}
+
+// wxImage Base64 is the encoded image, MD5 the md5 of the raw image
+type wxImage struct {
+	Base64 string `json:"base64"`
+	MD5    string `json:"md5"`
+}
+
+type wxFile struct {
+	MediaID string `json:"media_id"`
+}
+
+// wxTemplateCard a text_notice or news_notice card
+type wxTemplateCard struct {
+	CardType              string             `json:"card_type"`
+	Source                *wxCardSource      `json:"source,omitempty"`
+	MainTitle             *wxCardTitle       `json:"main_title,omitempty"`
+	EmphasisContent       *wxCardTitle       `json:"emphasis_content,omitempty"`
+	QuoteArea             *wxCardQuote       `json:"quote_area,omitempty"`
+	SubTitleText          string             `json:"sub_title_text,omitempty"`
+	CardImage             *wxCardImage       `json:"card_image,omitempty"`
+	HorizontalContentList []wxCardHorizontal `json:"horizontal_content_list,omitempty"`
+	JumpList              []wxCardJump       `json:"jump_list,omitempty"`
+	CardAction            *wxCardAction      `json:"card_action,omitempty"`
+}
+
+type wxCardSource struct {
+	IconURL   string `json:"icon_url,omitempty"`
+	Desc      string `json:"desc,omitempty"`
+	DescColor int    `json:"desc_color,omitempty"`
+}
+
+type wxCardTitle struct {
+	Title string `json:"title,omitempty"`
+	Desc  string `json:"desc,omitempty"`
+}
+
+type wxCardQuote struct {
+	Type      int    `json:"type,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Title     string `json:"title,omitempty"`
+	QuoteText string `json:"quote_text,omitempty"`
+}
+
+type wxCardImage struct {
+	URL         string  `json:"url"`
+	AspectRatio float64 `json:"aspect_ratio,omitempty"`
+}
+
+// wxCardHorizontal Type 1 is a link to URL
+type wxCardHorizontal struct {
+	KeyName string `json:"keyname"`
+	Value   string `json:"value,omitempty"`
+	Type    int    `json:"type,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+type wxCardJump struct {
+	Type  int    `json:"type"`
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title"`
+}
+
+// wxCardAction Type 1 opens URL
+type wxCardAction struct {
+	Type int    `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+func NewWeCom(cfg *WeComConfig) (*WeCom, error) {
+	if len(cfg.Key) == 0 {
+		return nil, fmt.Errorf("wecom.key is empty")
+	}
+	switch cfg.MsgType {
+	case "":
+		cfg.MsgType = "markdown"
+	case "markdown", "markdown_v2":
+	default:
+		return nil, fmt.Errorf("wecom.msgtype must be markdown or markdown_v2")
+	}
+	base := cfg.URL
+	if len(base) == 0 {
+		base = weComURL
+	}
+	return &WeCom{
+		cfg:    cfg,
+		url:    base + "?key=" + url.QueryEscape(cfg.Key),
+		client: NewClient(),
+	}, nil
+}
+
+// wxCardColors the desc_color of the card source, 2 is red and 3 green
+var wxCardColors = map[string]int{
+	"failed":  2,
+	"success": 3,
+}
+
+// buildWxCard builds a text_notice card of a pipeline, a job, a deployment or a merge request, other events return nil
+func buildWxCard(e *Event) *wxTemplateCard {
+	if len(e.URL) == 0 {
+		return nil
+	}
+	card := &wxTemplateCard{
+		CardType:   "text_notice",
+		Source:     &wxCardSource{Desc: e.Project, DescColor: wxCardColors[e.Status]},
+		JumpList:   []wxCardJump{{Type: 1, URL: e.URL, Title: actionText(e)}},
+		CardAction: &wxCardAction{Type: 1, URL: e.URL},
+	}
+	addField := func(name, value string) {
+		if len(value) > 0 {
+			card.HorizontalContentList = append(card.HorizontalContentList, wxCardHorizontal{KeyName: name, Value: value})
+		}
+	}
+	switch e.ObjectKind {
+	case "pipeline":
+		card.MainTitle = &wxCardTitle{Title: e.sprintf("Pipeline on %s %s", e.tr(e.RefType()), e.Ref), Desc: e.ProjectPath}
+		card.EmphasisContent = &wxCardTitle{Title: trans2Emoji(pipelineStatusEmoji[e.Status] + " " + e.tr(e.Status)), Desc: e.tr("Status")}
+		if e.Tag {
+			addField(e.tr("Tag"), e.Ref)
+		} else {
+			addField(e.tr("Branch"), e.Ref)
+		}
+		addField(e.tr("Author"), e.Author)
+		addField(e.tr("Duration"), formatDuration(e.Duration))
+		addField(e.tr("Finish at"), e.FinishedAt)
+	case "build":
+		card.MainTitle = &wxCardTitle{Title: e.sprintf("Job %s on %s %s", e.Job, e.tr(e.RefType()), e.Ref), Desc: e.ProjectPath}
+		card.EmphasisContent = &wxCardTitle{Title: trans2Emoji(pipelineStatusEmoji[e.Status] + " " + e.tr(e.Status)), Desc: e.tr("Status")}
+		addField(e.tr("Stage"), e.Stage)
+		addField(e.tr("Reason"), e.tr(e.FailureReason))
+		addField(e.tr("Runner"), e.Runner)
+		addField(e.tr("Author"), e.Author)
+		addField(e.tr("Duration"), formatDuration(e.Duration))
+	case "deployment":
+		card.MainTitle = &wxCardTitle{Title: e.sprintf("%s %s %s", e.Ref, e.deployed(), e.Environment), Desc: e.ProjectPath}
+		card.EmphasisContent = &wxCardTitle{Title: trans2Emoji(pipelineStatusEmoji[e.Status] + " " + e.tr(e.Status)), Desc: e.tr("Deployment")}
+		addField(e.tr("Environment"), e.Environment)
+		addField(e.tr("Tier"), e.EnvironmentTier)
+		for _, commit := range e.Commits {
+			addField(e.tr("Commit"), commit.Id+" "+firstLine(commit.Message))
+		}
+		addField(e.tr("Author"), e.Author)
+		if len(e.EnvironmentURL) > 0 {
+			card.JumpList = append(card.JumpList, wxCardJump{Type: 1, URL: e.EnvironmentURL, Title: e.tr("Open environment")})
+		}
+	case "merge_request":
+		card.MainTitle = &wxCardTitle{Title: e.Title, Desc: e.ProjectPath}
+		card.EmphasisContent = &wxCardTitle{Title: e.tr(e.Action), Desc: e.tr("Merge request")}
+		addField(e.tr("Branch"), e.SourceBranch+" → "+e.TargetBranch)
+		addField(e.tr("Author"), e.Author)
+		addField(e.tr("Labels"), strings.Join(e.Labels, ", "))
+	default:
+		return nil
+	}
+	return card
+}
+
+func (w *WeCom) buildMsg(msg *Message) *wxMsg {
+	if msg.Card && msg.Event != nil {
+		if card := buildWxCard(msg.Event); card != nil {
+			return &wxMsg{MsgType: "template_card", TemplateCard: card}
+		}
+	}
+	if !msg.Markdown {
+		return &wxMsg{MsgType: "text", Text: mentionText(msg.Content, msg.Mentions)}
+	}
+	if w.cfg.MsgType == "markdown_v2" {
+		return &wxMsg{MsgType: "markdown_v2", MarkdownV2: &wxMarkdown{Content: msg.Content}}
+	}
+	return &wxMsg{MsgType: "markdown", Markdown: &wxMarkdown{Content: msg.Content}}
+}
+
+// mentionText a text message pinging the users by wecom userid, or by mobile when the userid is unknown
+func mentionText(content string, users []*UserConfig) *wxText {
+	text := &wxText{Content: content}
+	for _, user := range users {
+		if len(user.WeComID) > 0 {
+			text.MentionedList = append(text.MentionedList, user.WeComID)
+		} else {
+			text.MentionedMobileList = append(text.MentionedMobileList, user.Mobile)
+		}
+	}
+	return text
+}
+
+func (w *WeCom) Markup() *Markup {
+	return MarkdownMarkup
+}
+
+// Limit the text content is limited to 2048 bytes, the markdown and markdown_v2 content to 4096 bytes,
+// the cards do not send the content
+func (w *WeCom) Limit(msg *Message) int {
+	switch w.buildMsg(msg).MsgType {
+	case "text":
+		return 2048
+	case "template_card":
+		return 0
+	}
+	return 4096
+}
+
+// RateLimit a group robot takes at most 20 messages a minute
+func (w *WeCom) RateLimit() (string, int) {
+	return w.url, wecomRateLimit
+}
+
+// FollowUp only text messages can mention, markdown and cards are followed by a short text,
+// it is a message of its own so a failed mention does not send the message again
+func (w *WeCom) FollowUp(msg *Message) *Message {
+	if len(msg.Mentions) == 0 || w.buildMsg(msg).MsgType == "text" {
+		return nil
+	}
+	content := msg.Title
+	if msg.Event != nil {
+		content = msg.Event.Project + ": " + msg.Event.Summary()
+	}
+	return &Message{Title: msg.Title, URL: msg.URL, Content: content, Recipients: msg.Recipients, Mentions: msg.Mentions}
+}
+
+func (w *WeCom) Send(msg *Message) (*WxResp, error) {
+	return w.post(w.buildMsg(msg))
+}
+
+func (w *WeCom) post(body *wxMsg) (*WxResp, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Request wexin robot err: %s", err)
+	}
+	defer resp.Body.Close()
+	// wexin always answers 200, a proxy in front of it may not
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &WxResp{ErrCode: int64(resp.StatusCode), ErrMsg: http.StatusText(resp.StatusCode)}, nil
+	}
+	wxResp := &WxResp{}
+	if err = json.NewDecoder(resp.Body).Decode(wxResp); err != nil {
+		return nil, fmt.Errorf("Decode wexin response err: %s, status %d", err, resp.StatusCode)
+	}
+	return wxResp, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hostileText quotes, backslashes, control characters, line separators and invalid utf-8
+const hostileText = "\"quoted\" \\ back\\slash \x00\x01\x1f\t\r\nnew line    <b>&amp;</b> `code` **bold** \xff\xfe\xc3 end"
+
+// hostile puts hostileText into every free text of the event
+func hostile(e *Event) {
+	e.Project += hostileText
+	e.Author += hostileText
+	e.Title += hostileText
+	e.Note += hostileText
+	e.Ref += hostileText
+	e.Stage += hostileText
+	e.FailureReason += hostileText
+	e.Description += hostileText
+	e.Labels = append(e.Labels, hostileText)
+	for i := range e.Commits {
+		e.Commits[i].Message += hostileText
+		e.Commits[i].Author += hostileText
+	}
+}
+
+// validUTF8 what encoding/json makes of s, every invalid byte becomes U+FFFD
+func validUTF8(s string) string {
+	return string([]rune(s))
+}
+
+func TestWeComHostilePayloads(t *testing.T) {
+	markdown, _ := NewWeCom(&WeComConfig{Key: "key"})
+	markdownV2, _ := NewWeCom(&WeComConfig{Key: "key", MsgType: "markdown_v2"})
+	news := func(msg *Message) *wxMsg {
+		article := wxArticle{Title: msg.Title, Description: msg.Content, URL: msg.Event.URL, PicURL: msg.Event.ProjectURL}
+		return &wxMsg{MsgType: "news", News: &wxNews{Articles: []wxArticle{article}}}
+	}
+	image := func(msg *Message) *wxMsg {
+		sum := md5.Sum([]byte(msg.Content))
+		return &wxMsg{MsgType: "image", Image: &wxImage{Base64: base64.StdEncoding.EncodeToString([]byte(msg.Content)), MD5: hex.EncodeToString(sum[:])}}
+	}
+	file := func(msg *Message) *wxMsg {
+		return &wxMsg{MsgType: "file", File: &wxFile{MediaID: msg.Content}}
+	}
+	cases := []struct {
+		name     string
+		build    func(msg *Message) *wxMsg
+		markdown bool
+		card     bool
+	}{
+		{"text", markdown.buildMsg, false, false},
+		{"markdown", markdown.buildMsg, true, false},
+		{"markdown_v2", markdownV2.buildMsg, true, false},
+		{"card", markdown.buildMsg, true, true},
+		{"news", news, true, false},
+		{"image", image, true, false},
+		{"file", file, true, false},
+	}
+	for kind := range samplePayloads {
+		event := sampleEvent(kind)
+		hostile(event)
+		for _, c := range cases {
+			msg := &Message{Title: event.Project, Content: renderEvent(event, MarkdownMarkup), Markdown: c.markdown, Card: c.card, Event: event}
+			body := c.build(msg)
+			data, err := json.Marshal(body)
+			if err != nil {
+				t.Fatalf("%s %s: marshal: %s", kind, c.name, err)
+			}
+			if !json.Valid(data) {
+				t.Fatalf("%s %s: invalid json %s", kind, c.name, data)
+			}
+			decoded := &wxMsg{}
+			if err = json.Unmarshal(data, decoded); err != nil {
+				t.Fatalf("%s %s: unmarshal: %s", kind, c.name, err)
+			}
+			if decoded.MsgType != body.MsgType {
+				t.Errorf("%s %s: msgtype %q, want %q", kind, c.name, decoded.MsgType, body.MsgType)
+			}
+			content := ""
+			switch decoded.MsgType {
+			case "text":
+				content = decoded.Text.Content
+			case "markdown":
+				content = decoded.Markdown.Content
+			case "markdown_v2":
+				content = decoded.MarkdownV2.Content
+			case "news":
+				article := decoded.News.Articles[0]
+				if article.Title != validUTF8(msg.Title) || article.URL != event.URL {
+					t.Errorf("%s %s: article %q %q, want %q %q", kind, c.name, article.Title, article.URL, msg.Title, event.URL)
+				}
+				content = article.Description
+			case "image":
+				raw, err := base64.StdEncoding.DecodeString(decoded.Image.Base64)
+				sum := md5.Sum(raw)
+				if err != nil || string(raw) != msg.Content || decoded.Image.MD5 != hex.EncodeToString(sum[:]) {
+					t.Errorf("%s %s: image does not decode to the content: %v", kind, c.name, err)
+				}
+				continue
+			case "file":
+				content = decoded.File.MediaID
+			case "template_card":
+				if decoded.TemplateCard.MainTitle.Title != validUTF8(body.TemplateCard.MainTitle.Title) {
+					t.Errorf("%s %s: card title %q, want %q", kind, c.name, decoded.TemplateCard.MainTitle.Title, body.TemplateCard.MainTitle.Title)
+				}
+				if decoded.TemplateCard.Source.Desc != validUTF8(event.Project) {
+					t.Errorf("%s %s: card source %q, want %q", kind, c.name, decoded.TemplateCard.Source.Desc, event.Project)
+				}
+				continue
+			default:
+				t.Fatalf("%s %s: unexpected msgtype %q", kind, c.name, decoded.MsgType)
+			}
+			if content != validUTF8(msg.Content) {
+				t.Errorf("%s %s: content %q, want %q", kind, c.name, content, msg.Content)
+			}
+		}
+	}
+}
+
+func TestWeComCardKinds(t *testing.T) {
+	for _, kind := range []string{"pipeline", "build", "deployment", "merge_request"} {
+		event := sampleEvent(kind)
+		hostile(event)
+		if card := buildWxCard(event); card == nil || card.MainTitle == nil {
+			t.Errorf("%s: no card", kind)
+		}
+	}
+	if card := buildWxCard(sampleEvent("push")); card != nil {
+		t.Errorf("push: unexpected card")
+	}
+}
+
+func TestWeComLimitByMsgType(t *testing.T) {
+	wecom, _ := NewWeCom(&WeComConfig{Key: "key"})
+	event := sampleEvent("note")
+	event.Note = strings.Repeat("long note ", 1000)
+	for template, limit := range map[string]int{TemplateText: 2048, TemplateMarkdown: 4096} {
+		target := Target{Name: "wecom", Notifier: wecom, Template: template, Renderer: defaultTemplate}
+		for _, msg := range target.messages(event, nil) {
+			if len(msg.Content) > limit {
+				t.Errorf("%s content of %d bytes, want at most %d", template, len(msg.Content), limit)
+			}
+		}
+	}
+}
+
+func TestWeComMentionFollowUpRetriedAlone(t *testing.T) {
+	var mu sync.Mutex
+	posts := []*wxMsg{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &wxMsg{}
+		json.NewDecoder(r.Body).Decode(body)
+		mu.Lock()
+		posts = append(posts, body)
+		n := len(posts)
+		mu.Unlock()
+		// the first mention fails
+		if n == 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+	wecom, _ := NewWeCom(&WeComConfig{Key: "key", URL: server.URL})
+	target := Target{Name: "wecom", Notifier: wecom, Template: TemplateMarkdown, Renderer: defaultTemplate}
+	msgs := target.messages(sampleEvent("pipeline"), []*UserConfig{{Username: "alice", WeComID: "alice"}})
+	if len(msgs) != 2 || len(msgs[0].Mentions) != 0 || len(msgs[1].Mentions) != 1 {
+		t.Fatalf("messages %+v, want the markdown followed by the mention", msgs)
+	}
+	q := NewQueue(10, 1, 3, nil)
+	q.Push(&Job{Target: target, Messages: msgs})
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 3 {
+		t.Fatalf("%d posts, want the markdown once and the mention twice", len(posts))
+	}
+	if posts[0].MsgType != "markdown" || posts[1].MsgType != "text" || posts[2].MsgType != "text" {
+		t.Errorf("posted %s, %s, %s", posts[0].MsgType, posts[1].MsgType, posts[2].MsgType)
+	}
+	if mentioned := posts[2].Text.MentionedList; len(mentioned) != 1 || mentioned[0] != "alice" {
+		t.Errorf("mentioned %v, want alice", mentioned)
+	}
+}